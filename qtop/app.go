@@ -1,65 +1,183 @@
 package qtop
 
 import (
-	"fmt"
-	"os/user"
 	"strings"
 	"time"
 
 	"github.com/gdamore/tcell"
 )
 
-const (
-	xMargin = 2
-	yMargin = 1
-)
+// spinnerInterval is the time between the frames of the spinner shown while
+// the clusters are queried.
+const spinnerInterval = time.Second / 10
+
+var spinnerFrames = []rune("⠋⠙⠹⠸⠼⠴⠦⠧⠇⠏")
 
 type Config struct {
 	Interval time.Duration
+
+	// Player, if not nil, drives the clusters from a recording. The App then
+	// advances the playback on each update and accepts playback keys.
+	Player *Player
+
+	// ConfigPath, if not empty, is the configuration file where the App saves
+	// settings changed interactively.
+	ConfigPath string
+
+	// Theme, if it has styles, overrides the default theme.
+	Theme Theme
+
+	// Keymap, if not nil, overrides the default key bindings.
+	Keymap Keymap
+
+	// Columns lists the names of the columns shown in the job list. The
+	// default columns are shown if empty.
+	Columns []string
+
+	// Teams maps team names to the usernames of the members, used by the team
+	// filter.
+	Teams map[string][]string
 }
 
+// A pane is a scrollable section of the screen.
+type pane int
+
+const (
+	paneNodes pane = iota
+	paneJobs
+)
+
 type App struct {
-	top    *Top
-	scr    tcell.Screen
-	quit   chan bool
-	update chan bool
-	config Config
+	clusters []Cluster
+	scr      tcell.Screen
+	renderer renderer
+	quit     chan bool
+	events   chan tcell.Event
+	results  chan clusterResult
+	details  chan jobAttrsResult
+	config   Config
+	theme    Theme
+	keymap   Keymap
+	columns  []jobColumn
+	tab      int
+	focus    pane
+	nodeView viewport
+	jobView  viewport
+	panel    *panel
+	detail   *jobDetail
+	picker   *columnPicker
+	prompt   *prompt
+	search   string
+	notice   string
+	legend   bool
+	running  bool
+
+	// pollers schedule the queries of the clusters, and errorLog records the
+	// recent failures.
+	pollers  []poller
+	errorLog []errorEntry
+
+	// paused is true if the automatic queries are paused.
+	paused bool
+
+	// advanced is the time the playback of a recording last advanced.
+	advanced time.Time
+
+	// frame counts the frames of the spinner.
+	frame int
+
+	// header is the screen row of the job list header, or -1 if not shown.
+	header int
+
+	// buttons are the mouse buttons held down, and lastClick is the last
+	// click used for detecting double-clicks.
+	buttons   tcell.ButtonMask
+	lastClick click
+
+	// clock returns the current time. Tests replace it to draw reproducible
+	// screens.
+	clock func() time.Time
 }
 
-func NewApp(top *Top, scr tcell.Screen, config Config) *App {
+// NewApp creates an App monitoring given clusters. If more than one cluster is
+// given, the App shows a tab for each cluster and a combined tab listing the
+// current user's jobs in all the clusters.
+func NewApp(clusters []Cluster, scr tcell.Screen, config Config) *App {
+	theme := config.Theme
+	if theme.Styles == nil {
+		theme, _ = LoadTheme(DefaultTheme)
+	}
+
+	keymap := config.Keymap
+	if keymap == nil {
+		keymap = DefaultKeymap()
+	}
+
 	return &App{
-		top:    top,
-		scr:    scr,
-		quit:   make(chan bool),
-		update: make(chan bool),
-		config: config,
+		clusters: clusters,
+		scr:      scr,
+		renderer: &screenRenderer{scr: scr, theme: theme},
+		quit:     make(chan bool),
+		events:   make(chan tcell.Event),
+		results:  make(chan clusterResult, len(clusters)),
+		details:  make(chan jobAttrsResult),
+		pollers:  make([]poller, len(clusters)),
+		config:   config,
+		theme:    theme,
+		keymap:   keymap,
+		columns:  selectJobColumns(config.Columns),
+		focus:    paneJobs,
+		header:   -1,
+		clock:    time.Now,
 	}
 }
 
+// Start runs the main loop until the App quits. The clusters are queried in
+// the background so that the screen keeps responding to keys while a query
+// is in flight. Failed queries are shown and retried without quitting.
 func (app *App) Start() error {
+	app.scr.EnableMouse()
 	go app.dispatch()
 
-	app.top.Update()
-	app.scr.Clear()
+	app.advanced = app.clock()
+	app.refreshAll()
+	app.redraw()
 
-	tick := time.Tick(app.config.Interval)
+	spin := time.Tick(spinnerInterval)
 
-loop:
-	for {
+	defer func() {
+		app.panel = nil
+		app.stopJobDetail()
+	}()
+
+	for app.running = true; app.running; {
 		select {
 		case <-app.quit:
-			break loop
-
-		case <-app.update:
-			app.scr.Clear()
-			app.draw()
+			app.running = false
 
-		case <-tick:
-			if err := app.top.Update(); err != nil {
+		case ev := <-app.events:
+			if err := app.handle(ev); err != nil {
 				return err
 			}
-			app.scr.Clear()
-			app.draw()
+			app.stopJobDetail()
+
+		case r := <-app.results:
+			app.receive(r)
+			app.redraw()
+
+		case r := <-app.details:
+			app.receiveJobAttrs(r)
+			app.redraw()
+
+		case now := <-spin:
+			app.poll(now)
+
+			// Animate the spinner, or update the age of the data and the retry
+			// countdown every second.
+			app.frame++
+			if app.fetching() || app.frame%int(time.Second/spinnerInterval) == 0 {
+				app.redraw()
+			}
 		}
 	}
 
@@ -70,291 +188,341 @@ func (app *App) Quit() {
 	app.quit <- true
 }
 
+// dispatch forwards terminal events to the main loop.
 func (app *App) dispatch() {
 	for {
 		ev := app.scr.PollEvent()
 		if ev == nil {
 			break
 		}
+		app.events <- ev
+	}
+}
 
-		switch ev := ev.(type) {
-		case *tcell.EventKey:
-			switch ev.Key() {
-			case tcell.KeyCtrlC:
-				app.quit <- true
+// handle processes a terminal event in the main loop.
+func (app *App) handle(ev tcell.Event) error {
+	switch ev := ev.(type) {
+	case *tcell.EventKey:
+		return app.handleKey(ev)
 
-			case tcell.KeyCtrlL:
-				app.scr.Sync()
+	case *tcell.EventMouse:
+		app.handleMouse(ev)
 
-			case tcell.KeyRune:
-				switch ev.Rune() {
-				case 'q', 'Q':
-					app.quit <- true
-				}
-			}
+	case *tcell.EventResize:
+		app.redraw()
+	}
+	return nil
+}
+
+func (app *App) handleKey(ev *tcell.EventKey) error {
+	app.notice = ""
 
-		case *tcell.EventResize:
-			app.update <- true
+	if app.prompt != nil && ev.Key() != tcell.KeyCtrlC {
+		if !app.prompt.handleKey(ev) {
+			app.prompt = nil
 		}
+		app.redraw()
+		return nil
 	}
-}
 
-func (app *App) draw() {
-	sum := app.top.Current()
+	if app.panel != nil && ev.Key() != tcell.KeyCtrlC {
+		if !app.panel.handleKey(ev) {
+			app.panel = nil
+		}
+		app.redraw()
+		return nil
+	}
 
-	y := 0
-	y = app.drawCluster(y, sum.Cluster) + yMargin
-	y = app.drawNodes(y, sum.Nodes) + yMargin
-	y = app.drawJobs(y, sum.Jobs)
+	if app.picker != nil && ev.Key() != tcell.KeyCtrlC {
+		if !app.picker.handleKey(ev) {
+			app.picker = nil
+		}
+		app.redraw()
+		return nil
+	}
 
-	app.scr.Show()
-}
+	// Ctrl-C always quits regardless of the key bindings.
+	if ev.Key() == tcell.KeyCtrlC {
+		app.running = false
+		return nil
+	}
 
-func (app *App) drawCluster(y int, cluster ClusterSummary) int {
-	scr := app.scr
-	w, _ := scr.Size()
+	switch action := app.keymap.action(ev); action {
+	case actionQuit:
+		app.running = false
 
-	now := time.Now().Format(time.Stamp)
-	printStr(scr, w-len(now)-xMargin, 0, now, tcell.StyleDefault)
+	case actionRedraw:
+		app.scr.Sync()
 
-	stat := fmt.Sprintf(
-		"%d running, %d waiting / %d free",
-		cluster.RunningJobs,
-		cluster.WaitingJobs,
-		cluster.FreeSlots,
-	)
-	printStr(scr, 2, 0, stat, tcell.StyleDefault)
+	case actionNextTab:
+		app.switchTab(1)
 
-	return y + 1
-}
+	case actionPrevTab:
+		app.switchTab(-1)
 
-func (app *App) drawNodes(y int, nodes []NodeSummary) int {
-	scr := app.scr
+	case actionUp:
+		app.focusedView().move(-1)
 
-	nodeCols := 0
-	for _, node := range nodes {
-		if len(node.Name) > nodeCols {
-			nodeCols = len(node.Name)
-		}
-	}
+	case actionDown:
+		app.focusedView().move(1)
 
-	// Node name and meter
+	case actionPageUp:
+		app.focusedView().page(-1)
 
-	yStart := y
-	xRight := 0
+	case actionPageDown:
+		app.focusedView().page(1)
 
-	for _, node := range nodes {
-		name := fmt.Sprintf("%*s", -nodeCols, node.Name)
-		util := fmt.Sprintf("[%2d/%2d]", node.UsedSlots, node.AvailSlots)
-		meter := strings.Repeat("|", node.UsedSlots)
-		meterFree := strings.Repeat(".", node.AvailSlots-node.UsedSlots)
-		color := tcell.ColorTeal
+	case actionTop:
+		app.focusedView().home()
 
-		if !node.Active {
-			util = "[--/--]"
-			color = tcell.ColorGray
-		}
+	case actionBottom:
+		app.focusedView().end()
 
-		x := xMargin
-		x += printStr(scr, x, y, name, tcell.StyleDefault.Foreground(color))
-		x += 1
-		x += printStr(scr, x, y, util, tcell.StyleDefault.Foreground(tcell.ColorGray))
-		x += 1
-		x += printStr(scr, x, y, meter, tcell.StyleDefault.Foreground(tcell.ColorGreen))
-		x += printStr(scr, x, y, meterFree, tcell.StyleDefault.Foreground(tcell.ColorGray))
+	case actionOpen:
+		app.openSelected()
 
-		if x > xRight {
-			xRight = x
-		}
-		y++
-	}
+	case actionClear:
+		app.search = ""
 
-	// Node owners
+	case actionFocus:
+		app.toggleFocus()
 
-	y = yStart
-	me, _ := user.Current()
+	case actionLegend:
+		app.legend = !app.legend
 
-	for _, node := range nodes {
-		x := xRight + xMargin
+	case actionFilter:
+		app.openFilterPrompt()
 
-		for _, ownerSum := range node.Owners {
-			user := abbrevUsername(ownerSum.Owner)
-			info := fmt.Sprintf("%d:%s", ownerSum.Occupancy, user)
+	case actionSearch:
+		app.openSearchPrompt()
 
-			style := tcell.StyleDefault
-			if user != me.Username {
-				style = style.Foreground(tcell.ColorGray)
-			}
+	case actionSortNext:
+		app.setJobOrder(app.jobOrder().Next(1))
 
-			x += printStr(scr, x, y, info, style)
-			x += 1
-		}
+	case actionSortPrev:
+		app.setJobOrder(app.jobOrder().Next(-1))
 
-		y++
-	}
+	case actionSortReverse:
+		app.setJobOrder(app.jobOrder().Reverse())
 
-	return y
-}
+	case actionGroup:
+		app.cycleGrouping()
 
-func (app *App) drawJobs(y int, jobs []JobSummary) int {
-	y = app.drawJobHeader(y)
+	case actionColumns:
+		app.openColumnPicker()
 
-	for _, job := range jobs {
-		y = app.drawJob(y, job)
-	}
+	case actionErrors:
+		app.openErrorLog()
 
-	return y
-}
+	case actionHelp:
+		app.openHelp()
+
+	case actionNextMatch:
+		app.jumpToMatch(1, false)
 
-func (app *App) drawJobHeader(y int) int {
-	style := tcell.StyleDefault.Foreground(tcell.ColorBlack).Background(tcell.ColorGreen)
-
-	scr := app.scr
-	w, _ := scr.Size()
-	wjob := app.calcJobWidth(w)
-
-	x := 0
-	x += printStr(scr, x, y, "  ", style)
-	x += printStr(scr, x, y, fmt.Sprintf("%-10s", "USER"), style)
-	x += printStr(scr, x, y, " ", style)
-	x += printStr(scr, x, y, "JOB"+strings.Repeat(" ", wjob-3), style)
-	x += printStr(scr, x, y, " ", style)
-	x += printStr(scr, x, y, "S", style)
-	x += printStr(scr, x, y, " ", style)
-	x += printStr(scr, x, y, "NJOB", style)
-	x += printStr(scr, x, y, " ", style)
-	x += printStr(scr, x, y, "NCPU", style)
-	x += printStr(scr, x, y, " ", style)
-	x += printStr(scr, x, y, fmt.Sprintf("%6s", "CPU%"), style)
-	x += printStr(scr, x, y, " ", style)
-	x += printStr(scr, x, y, fmt.Sprintf("%9s", "MAX TIME"), style)
-	x += printStr(scr, x, y, " ", style)
-	x += printStr(scr, x, y, "JID", style)
-
-	if x < w {
-		x += printStr(scr, x, y, strings.Repeat(" ", w-x), style)
+	case actionPrevMatch:
+		app.jumpToMatch(-1, false)
+
+	case actionRefresh:
+		app.refreshAll()
+
+	case actionIncInterval:
+		app.setInterval(stepInterval(app.config.Interval, 1))
+
+	case actionDecInterval:
+		app.setInterval(stepInterval(app.config.Interval, -1))
+
+	case actionPause:
+		if app.config.Player == nil {
+			app.togglePause()
+			break
+		}
+		app.controlPlayback(action)
+		app.refreshAll()
+
+	case actionStepForward, actionStepBack, actionFaster, actionSlower:
+		if app.config.Player != nil {
+			app.controlPlayback(action)
+			app.refreshAll()
+		}
 	}
 
-	return y + 1
+	app.redraw()
+	return nil
 }
 
-func (app *App) calcJobWidth(w int) int {
-	wjob := (w - 32) * 2 / 5
-	if wjob < 20 {
-		wjob = 20
-	}
-	return wjob
+// switchTab switches to the delta-th next cluster tab.
+func (app *App) switchTab(delta int) {
+	app.tab = (app.tab + delta + app.tabCount()) % app.tabCount()
+	app.nodeView = viewport{}
+	app.jobView = viewport{}
 }
 
-func (app *App) drawJob(y int, job JobSummary) int {
-	owner := abbrevUsername(job.Owner)
-	maxTime := formatClock(job.MaxWalltime)
+// toggleFocus moves the keyboard focus to the other pane.
+func (app *App) toggleFocus() {
+	if app.focus == paneJobs && !app.showsMine() {
+		app.focus = paneNodes
+	} else {
+		app.focus = paneJobs
+	}
+}
 
-	style := tcell.StyleDefault
-	styleUser := style
-	styleState := style
-	styleJID := style.Foreground(tcell.ColorTeal)
+// focusedView returns the viewport of the focused pane.
+func (app *App) focusedView() *viewport {
+	if app.focus == paneNodes && !app.showsMine() {
+		return &app.nodeView
+	}
+	return &app.jobView
+}
 
-	me, _ := user.Current()
-	if owner != me.Username {
-		styleUser = styleUser.Foreground(tcell.ColorGray)
-		styleJID = styleJID.Foreground(tcell.ColorGray)
+// openSelected opens the detail panel of the node or the job selected in the
+// focused pane.
+func (app *App) openSelected() {
+	if app.showsMine() {
+		rows := app.mineRows()
+		if app.jobView.cursor < len(rows) {
+			row := rows[app.jobView.cursor]
+			if row.job != nil {
+				app.openJobDetail(app.clusters[row.cluster], *row.job)
+			}
+		}
+		return
 	}
 
-	switch job.State {
-	case "R":
-		styleState = styleState.Foreground(tcell.ColorGreen)
-	case "C", "E":
-		styleState = styleState.Foreground(tcell.ColorOlive)
-	case "H", "Q", "T", "W":
-		styleState = styleState.Foreground(tcell.ColorTeal)
+	cluster := app.clusters[app.tab]
+	sum := cluster.Top.Current()
+	if sum == nil {
+		return
 	}
 
-	scr := app.scr
-	w, _ := scr.Size()
-	wjob := app.calcJobWidth(w)
-
-	x := xMargin
-	x += printStr(scr, x, y, fmt.Sprintf("%-10s", owner), styleUser)
-	x += printStr(scr, x, y, " ", style)
-	printStr(scr, x, y, job.Name, style)
-	x += wjob
-	x += printStr(scr, x, y, " ", style)
-	x += printStr(scr, x, y, job.State, styleState)
-	x += printStr(scr, x, y, " ", style)
-	x += printStr(scr, x, y, fmt.Sprintf("%4d", job.Count), style)
-	x += printStr(scr, x, y, " ", style)
-	x += printStr(scr, x, y, fmt.Sprintf("%4d", job.Occupancy), style)
-	x += printStr(scr, x, y, " ", style)
-	x += printStr(scr, x, y, fmt.Sprintf("%6.1f", job.CPUUsage*100), style)
-	x += printStr(scr, x, y, " ", style)
-	x += printStr(scr, x, y, maxTime, style)
-	x += printStr(scr, x, y, " ", style)
-	x += printStr(scr, x, y, compressIDs(job.IDs), styleJID)
-
-	return y + 1
-}
+	if app.focus == paneNodes {
+		nodes := sum.Nodes
+		if app.nodeView.cursor < len(nodes) {
+			app.openNodeDetail(cluster, nodes[app.nodeView.cursor])
+		}
+		return
+	}
 
-func printStr(scr tcell.Screen, x, y int, s string, style tcell.Style) int {
-	for i, c := range s {
-		scr.SetContent(x+i, y, c, nil, style)
+	jobs := sum.Jobs
+	if app.jobView.cursor < len(jobs) {
+		app.openJobDetail(cluster, jobs[app.jobView.cursor])
 	}
-	return len(s)
 }
 
-func formatClock(n int) string {
-	sec := n
-	min := sec / 60
-	hour := min / 60
+// openFilterPrompt prompts for a filter expression to apply to all the
+// clusters.
+func (app *App) openFilterPrompt() {
+	current := app.clusters[0].Top.Options().Filter
+
+	app.prompt = newPrompt("filter", current.String(), func(expr string) error {
+		filter, err := ParseFilter(expr)
+		if err != nil {
+			return err
+		}
+
+		filter, err = filter.WithTeams(app.config.Teams)
+		if err != nil {
+			return err
+		}
+
+		app.setOptions(func(opts *Options) {
+			opts.Filter = filter
+		})
+		app.jobView.home()
 
-	return fmt.Sprintf("%3d:%02d:%02d", hour, min%60, sec%60)
+		return nil
+	})
 }
 
-func abbrevUsername(s string) string {
-	return s[:strings.Index(s, "@")]
+// setJobOrder changes the order of the job groups in all the clusters.
+func (app *App) setJobOrder(order JobOrder) {
+	app.setOptions(func(opts *Options) {
+		opts.Order = order
+	})
 }
 
-func compressIDs(ids []string) string {
-	prefix := commonPrefix(ids)
-	if strings.HasSuffix(prefix, "[") {
-		return prefix + "]"
-	}
+// cycleGrouping switches all the clusters to the next group mode and saves the
+// mode to the configuration file.
+func (app *App) cycleGrouping() {
+	mode := app.clusters[0].Top.Options().Grouping.Mode.Next()
 
-	shortIDs := []string{}
-	for _, id := range ids {
-		shortIDs = append(shortIDs, abbrevID(id))
+	app.setOptions(func(opts *Options) {
+		opts.Grouping.Mode = mode
+	})
+	app.notice = "grouping: " + mode.String()
+
+	if path := app.config.ConfigPath; path != "" {
+		if err := SetConfigValue(path, "grouping", mode.String()); err != nil {
+			app.notice = "cannot save grouping: " + err.Error()
+		}
 	}
-	return strings.Join(shortIDs, " ")
 }
 
-func abbrevID(s string) string {
-	return s[:strings.Index(s, ".")]
+// openColumnPicker opens the overlay choosing the columns of the job list. The
+// chosen columns are saved to the configuration file.
+func (app *App) openColumnPicker() {
+	app.picker = newColumnPicker(app.columns, func(cols []jobColumn) {
+		app.columns = cols
+
+		specs := []string{}
+		for _, col := range cols {
+			specs = append(specs, formatColumnSpec(col))
+		}
+		app.notice = "columns: " + strings.Join(specs, " ")
+
+		if path := app.config.ConfigPath; path != "" {
+			if err := SetConfigList(path, "columns", specs); err != nil {
+				app.notice = "cannot save columns: " + err.Error()
+			}
+		}
+	})
 }
 
-func commonPrefix(arr []string) string {
-	if len(arr) == 0 {
-		return ""
+// controlPlayback performs a playback action: pause or resume, step forward or
+// backward, and double or halve the speed.
+func (app *App) controlPlayback(action string) {
+	player := app.config.Player
+
+	switch action {
+	case actionPause:
+		player.TogglePause()
+	case actionStepForward:
+		player.Step(1)
+	case actionStepBack:
+		player.Step(-1)
+	case actionFaster:
+		player.ScaleSpeed(2)
+	case actionSlower:
+		player.ScaleSpeed(0.5)
 	}
+}
 
-	prefix := arr[0]
-	for _, s := range arr[1:] {
-		prefix = prefix[:mismatch(prefix, s)]
+// tabCount returns the number of tabs the App switches between.
+func (app *App) tabCount() int {
+	if len(app.clusters) > 1 {
+		return len(app.clusters) + 1
 	}
-	return prefix
+	return 1
 }
 
-func mismatch(s1, s2 string) int {
-	var n int
-	if len(s1) < len(s2) {
-		n = len(s1)
-	} else {
-		n = len(s2)
-	}
+// showsMine returns true if the combined tab of the current user's jobs is
+// shown.
+func (app *App) showsMine() bool {
+	return app.tab == len(app.clusters)
+}
 
-	for i := 0; i < n; i++ {
-		if s1[i] != s2[i] {
-			return i
-		}
+// jobOrder returns the order of the job groups, which is common to all the
+// clusters.
+func (app *App) jobOrder() JobOrder {
+	return app.clusters[0].Top.Options().Order
+}
+
+// setOptions changes the summarizing options of all the clusters by applying
+// change to the current options.
+func (app *App) setOptions(change func(opts *Options)) {
+	for _, cluster := range app.clusters {
+		opts := cluster.Top.Options()
+		change(&opts)
+		cluster.Top.SetOptions(opts)
 	}
-	return n
 }
@@ -0,0 +1,288 @@
+package qtop
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell"
+	"github.com/mattn/go-runewidth"
+)
+
+func newTestScreen(t *testing.T, w, h int) tcell.SimulationScreen {
+	scr := tcell.NewSimulationScreen("UTF-8")
+	if err := scr.Init(); err != nil {
+		t.Fatal(err)
+	}
+	scr.SetSize(w, h)
+	return scr
+}
+
+// screenRow returns the text shown in row y of scr, with the trailing spaces
+// removed.
+func screenRow(scr tcell.SimulationScreen, y int) string {
+	scr.Show()
+	cells, w, _ := scr.GetContents()
+
+	row := ""
+	for x := 0; x < w; {
+		runes := cells[y*w+x].Runes
+		if len(runes) == 0 {
+			runes = []rune{' '}
+		}
+		row += string(runes)
+
+		if n := runewidth.RuneWidth(runes[0]); n > 1 {
+			x += n
+		} else {
+			x++
+		}
+	}
+	return strings.TrimRight(row, " ")
+}
+
+func Test_printStr_WideCharacters(t *testing.T) {
+	scr := newTestScreen(t, 20, 1)
+
+	n := printStr(scr, 1, 0, "解析🚀ab", tcell.StyleDefault)
+	if n != 8 {
+		t.Errorf("unexpected width: %d", n)
+	}
+	printStr(scr, 1+n, 0, "|", tcell.StyleDefault)
+
+	if actual := screenRow(scr, 0); actual != " 解析🚀ab|" {
+		t.Errorf("unexpected row: %q", actual)
+	}
+}
+
+func Test_printStr_CombiningCharacters(t *testing.T) {
+	scr := newTestScreen(t, 20, 1)
+
+	n := printStr(scr, 0, 0, "éx", tcell.StyleDefault)
+	if n != 2 {
+		t.Errorf("unexpected width: %d", n)
+	}
+
+	c, comb, _, _ := scr.GetContent(0, 0)
+	if c != 'e' || string(comb) != "́" {
+		t.Errorf("unexpected cell: %q %q", c, comb)
+	}
+	if c, _, _, _ := scr.GetContent(1, 0); c != 'x' {
+		t.Errorf("unexpected cell: %q", c)
+	}
+}
+
+func Test_truncate_FitsWidth(t *testing.T) {
+	testCases := []struct {
+		text   string
+		width  int
+		result string
+	}{
+		{"analysis", 10, "analysis"},
+		{"analysis", 8, "analysis"},
+		{"analysis", 5, "anal…"},
+		{"解析ジョブ", 10, "解析ジョブ"},
+		{"解析ジョブ", 7, "解析ジ…"},
+		{"解析ジョブ", 6, "解析…"},
+		{"🚀launch", 4, "🚀l…"},
+		{"🚀launch", 2, "…"},
+		{"analysis", 0, ""},
+	}
+
+	for _, tc := range testCases {
+		actual := truncate(tc.text, tc.width)
+		if actual != tc.result {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tc.text, tc.width, actual, tc.result)
+		}
+		if textWidth(actual) > tc.width {
+			t.Errorf("truncate(%q, %d) is too wide", tc.text, tc.width)
+		}
+	}
+}
+
+func Test_padLeft_CountsScreenColumns(t *testing.T) {
+	if actual := padLeft("解析", 6); actual != "  解析" {
+		t.Errorf("unexpected result: %q", actual)
+	}
+	if actual := padRight("🚀", 4); actual != "🚀  " {
+		t.Errorf("unexpected result: %q", actual)
+	}
+}
+
+// newTestRenderer returns a renderer drawing on scr in the default theme.
+func newTestRenderer(scr tcell.Screen) *screenRenderer {
+	theme, _ := LoadTheme(DefaultTheme)
+	return &screenRenderer{scr: scr, theme: theme}
+}
+
+func Test_drawJob_AlignsWideNames(t *testing.T) {
+	scr := newTestScreen(t, 40, 3)
+	r := newTestRenderer(scr)
+	columns := selectJobColumns([]string{"user", "job:10", "state", "ncpu"})
+
+	jobs := []JobSummary{
+		{Owner: "alice", Name: "解析ジョブ一覧", State: "R", Occupancy: 4},
+		{Owner: "bob", Name: "🚀launch", State: "Q", Occupancy: 0},
+		{Owner: "carol", Name: "plain", State: "R", Occupancy: 12},
+	}
+	for i, job := range jobs {
+		r.drawJob(i, columns, jobRow{job: job})
+	}
+
+	expected := []string{
+		"  alice      解析ジョ…  R    4",
+		"  bob        🚀launch   Q    0",
+		"  carol      plain      R   12",
+	}
+	for y, row := range expected {
+		if actual := screenRow(scr, y); actual != row {
+			t.Errorf("row %d: got %q, want %q", y, actual, row)
+		}
+	}
+}
+
+func Test_drawJob_TruncatesFlexibleColumns(t *testing.T) {
+	scr := newTestScreen(t, 30, 1)
+	r := newTestRenderer(scr)
+	columns := selectJobColumns([]string{"state", "job", "njob"})
+
+	job := JobSummary{Name: "非常に長いジョブの名前です", State: "R", Count: 3}
+	r.drawJob(0, columns, jobRow{job: job})
+
+	actual := screenRow(scr, 0)
+	if actual != "  R 非常に長いジョブの…     3" {
+		t.Errorf("unexpected row: %q", actual)
+	}
+	if c, _, _, _ := scr.GetContent(28, 0); c != '3' {
+		t.Errorf("count is not aligned: %q", actual)
+	}
+}
+
+// scriptedSource is a Source whose queries block until an outcome is sent:
+// nil for success or an error for failure. A successful query returns snap,
+// or an empty snapshot if snap is nil.
+type scriptedSource struct {
+	outcomes chan error
+	snap     *Snapshot
+}
+
+func newScriptedSource() scriptedSource {
+	return scriptedSource{outcomes: make(chan error, 1)}
+}
+
+func (src scriptedSource) Query() (*Snapshot, error) {
+	if err := <-src.outcomes; err != nil {
+		return nil, err
+	}
+	if src.snap != nil {
+		return src.snap, nil
+	}
+	return &Snapshot{Time: time.Now()}, nil
+}
+
+func (src scriptedSource) Close() error {
+	return nil
+}
+
+func Test_App_QuitsWhileQuerying(t *testing.T) {
+	scr := newTestScreen(t, 80, 24)
+	defer scr.Fini()
+
+	src := newScriptedSource()
+	defer func() { src.outcomes <- errors.New("closed") }()
+
+	clusters := []Cluster{{Name: "slow", Top: NewSourceTop(src)}}
+	app := NewApp(clusters, scr, Config{Interval: time.Hour})
+
+	done := make(chan error)
+	go func() {
+		done <- app.Start()
+	}()
+
+	scr.InjectKey(tcell.KeyCtrlC, 0, tcell.ModNone)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("app does not quit while querying")
+	}
+}
+
+func Test_App_ShowsDataAfterQuery(t *testing.T) {
+	scr := newTestScreen(t, 80, 24)
+	defer scr.Fini()
+
+	src := newScriptedSource()
+	clusters := []Cluster{{Name: "slow", Top: NewSourceTop(src)}}
+	app := NewApp(clusters, scr, Config{Interval: time.Hour})
+
+	app.refreshAll()
+	app.redraw()
+	if row := screenRow(scr, 0); !strings.HasPrefix(row, "  Querying slow…") {
+		t.Errorf("unexpected row while querying: %q", row)
+	}
+
+	src.outcomes <- nil
+	app.receive(<-app.results)
+	if app.fetching() {
+		t.Errorf("query is not completed")
+	}
+
+	app.redraw()
+	if row := screenRow(scr, 0); !strings.HasPrefix(row, "  0 running, 0 waiting") || !strings.Contains(row, "0s ago, next 1h") {
+		t.Errorf("unexpected row after query: %q", row)
+	}
+}
+
+func Test_App_ShowsErrorStatus(t *testing.T) {
+	scr := newTestScreen(t, 80, 24)
+	defer scr.Fini()
+
+	src := newScriptedSource()
+	clusters := []Cluster{{Name: "flaky", Top: NewSourceTop(src)}}
+	app := NewApp(clusters, scr, Config{Interval: time.Minute})
+
+	app.refreshAll()
+	src.outcomes <- nil
+	app.receive(<-app.results)
+
+	app.refreshAll()
+	src.outcomes <- errors.New("connection refused")
+	app.receive(<-app.results)
+
+	app.redraw()
+	if row := screenRow(scr, 0); !strings.HasPrefix(row, "  0 running, 0 waiting") {
+		t.Errorf("last summary is not shown: %q", row)
+	}
+
+	status := screenRow(scr, 23)
+	if !strings.HasPrefix(status, "  E: errors  flaky: connection refused (retry in ") {
+		t.Errorf("unexpected status: %q", status)
+	}
+	if _, _, style, _ := scr.GetContent(79, 23); style != app.theme.style(roleError) {
+		t.Errorf("status bar is not styled")
+	}
+}
+
+func Test_formatDuration(t *testing.T) {
+	testCases := []struct {
+		age    time.Duration
+		result string
+	}{
+		{-time.Second, "0s"},
+		{1500 * time.Millisecond, "1s"},
+		{59 * time.Second, "59s"},
+		{150 * time.Second, "2m"},
+		{3 * time.Hour, "3h"},
+	}
+
+	for _, tc := range testCases {
+		if actual := formatDuration(tc.age); actual != tc.result {
+			t.Errorf("formatDuration(%s) = %q, want %q", tc.age, actual, tc.result)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package qtop
+
+import (
+	"fmt"
+	"sync"
+)
+
+// A Cluster is a Top attached to a named PBS server.
+type Cluster struct {
+	Name string
+	Top  *Top
+}
+
+// UpdateClusters updates all clusters concurrently. It returns the first error
+// encountered, prefixed with the name of the failed cluster.
+func UpdateClusters(clusters []Cluster) error {
+	return applyClusters(clusters, fetchClusters(clusters))
+}
+
+// fetchClusters queries all clusters concurrently without changing them.
+func fetchClusters(clusters []Cluster) []fetchResult {
+	results := make([]fetchResult, len(clusters))
+
+	var wg sync.WaitGroup
+	for i := range clusters {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = clusters[i].Top.fetch()
+		}(i)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// applyClusters updates the clusters with the results of fetchClusters. It
+// returns the first error encountered, prefixed with the name of the failed
+// cluster.
+func applyClusters(clusters []Cluster, results []fetchResult) error {
+	var first error
+
+	for i, r := range results {
+		if err := clusters[i].Top.apply(r); err != nil && first == nil {
+			first = fmt.Errorf("%s: %s", clusters[i].Name, err)
+		}
+	}
+	return first
+}
@@ -0,0 +1,128 @@
+package main
+
+// dashboardHTML is the web dashboard served by qtop serve. It is a format
+// string taking the refresh interval in milliseconds.
+const dashboardHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>qtop</title>
+<style>
+body { background: #1c1c1c; color: #d0d0d0; font: 14px monospace; margin: 1em 2em; }
+h2 { font-size: 14px; margin: 1.5em 0 0.5em; }
+table { border-collapse: collapse; }
+td, th { padding: 0 0.5em; white-space: pre; text-align: left; }
+th { background: #5f8700; color: #000; }
+.num { text-align: right; }
+.node { color: #00afaf; }
+.down { color: #808080; }
+.used { color: #5faf00; }
+.free, .other { color: #808080; }
+.R { color: #5faf00; }
+.C, .E { color: #afaf00; }
+.H, .Q, .T, .W { color: #00afaf; }
+#error { color: #d75f5f; }
+</style>
+</head>
+<body>
+<div id="error"></div>
+<div id="clusters"></div>
+<script>
+"use strict";
+
+const interval = %d;
+
+function el(tag, attrs, ...children) {
+  const e = document.createElement(tag);
+  Object.assign(e, attrs);
+  e.append(...children);
+  return e;
+}
+
+function user(owner) {
+  const n = owner.indexOf("@");
+  return n < 0 ? owner : owner.slice(0, n);
+}
+
+function clock(sec) {
+  const pad = n => String(n).padStart(2, "0");
+  return Math.floor(sec / 3600) + ":" + pad(Math.floor(sec / 60) %% 60) + ":" + pad(sec %% 60);
+}
+
+function shortID(id) {
+  const n = id.indexOf(".");
+  return n < 0 ? id : id.slice(0, n);
+}
+
+function renderNodes(nodes) {
+  const table = el("table", {});
+  for (const node of nodes) {
+    const meter = node.active
+      ? [
+          el("span", {className: "used"}, "|".repeat(node.used_slots)),
+          el("span", {className: "free"}, ".".repeat(Math.max(node.avail_slots - node.used_slots, 0))),
+        ]
+      : [el("span", {className: "down"}, ".".repeat(node.avail_slots))];
+    const util = node.active
+      ? "[" + node.used_slots + "/" + node.avail_slots + "]"
+      : "[--/--]";
+    const owners = node.owners.map(o => o.occupancy + ":" + user(o.owner)).join(" ");
+    table.append(el("tr", {},
+      el("td", {className: node.active ? "node" : "down"}, node.name),
+      el("td", {className: "down"}, util),
+      el("td", {}, ...meter),
+      el("td", {className: "other"}, owners),
+    ));
+  }
+  return table;
+}
+
+function renderJobs(jobs) {
+  const header = ["USER", "JOB", "S", "NJOB", "NCPU", "CPU%%", "MAX TIME", "JID"];
+  const table = el("table", {}, el("tr", {}, ...header.map(h => el("th", {}, h))));
+  for (const job of jobs) {
+    table.append(el("tr", {},
+      el("td", {}, user(job.owner)),
+      el("td", {}, job.name),
+      el("td", {className: job.state}, job.state),
+      el("td", {className: "num"}, String(job.count)),
+      el("td", {className: "num"}, String(job.occupancy)),
+      el("td", {className: "num"}, (job.cpu_usage * 100).toFixed(1)),
+      el("td", {className: "num"}, clock(job.max_walltime)),
+      el("td", {className: "node"}, job.ids.map(shortID).join(" ")),
+    ));
+  }
+  return table;
+}
+
+async function refresh() {
+  try {
+    const res = await fetch("api/summary" + location.search);
+    if (!res.ok) {
+      throw new Error(await res.text());
+    }
+    const data = await res.json();
+    const root = document.getElementById("clusters");
+    root.replaceChildren();
+    for (const cluster of data.clusters) {
+      const c = cluster.cluster;
+      root.append(
+        el("h2", {}, cluster.name + ": " + c.running_jobs + " running, " +
+          c.waiting_jobs + " waiting / " + c.free_slots + " free"),
+        renderNodes(cluster.nodes),
+        el("h2", {}, ""),
+        renderJobs(cluster.jobs),
+      );
+    }
+    document.getElementById("error").textContent = "";
+  } catch (err) {
+    document.getElementById("error").textContent = String(err);
+  }
+}
+
+refresh();
+setInterval(refresh, interval);
+</script>
+</body>
+</html>
+`
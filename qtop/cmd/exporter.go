@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/snsinfu/torque-qtop/qtop"
+)
+
+const exporterUsage = `
+Serve PBS cluster metrics in the Prometheus text format
+
+Usage:
+  qtop exporter [-h] [-t <interval>] [--listen <address>] [--textfile <path>]
+                [-s <server>]...
+
+Options:
+  -t <interval>           Specify update interval in seconds [default: 15]
+  -s, --server <server>   Monitor PBS server at host[:port]. Repeat to monitor
+                          multiple servers. Defaults to the active server
+  --listen <address>      Serve metrics at http://<address>/metrics. Defaults
+                          to :9750 unless --textfile is given
+  --textfile <path>       Write metrics to this file for the textfile collector
+                          of node_exporter
+  -h, --help              Print this help message and exit
+`
+
+const defaultListen = ":9750"
+
+// Timeouts of the HTTP servers. Requests and responses are small, so a client
+// taking longer than these is stuck or malicious.
+const (
+	httpReadHeaderTimeout = 10 * time.Second
+	httpWriteTimeout      = 30 * time.Second
+)
+
+type exporterConfig struct {
+	Interval float64  `docopt:"-t"`
+	Servers  []string `docopt:"--server"`
+	Listen   string   `docopt:"--listen"`
+	Textfile string   `docopt:"--textfile"`
+}
+
+func (c *exporterConfig) validate() error {
+	if c.Interval < minInterval {
+		return errors.New("update interval is too short")
+	}
+	return nil
+}
+
+// exporter periodically queries the clusters and keeps the latest metrics.
+type exporter struct {
+	clusters []qtop.Cluster
+	textfile string
+	mutex    sync.RWMutex
+	metrics  []byte
+}
+
+// runExporter serves the cluster metrics over HTTP and/or writes them to a
+// textfile-collector file until the program is terminated.
+func runExporter(c exporterConfig) error {
+	clusters, err := dialClusters(c.Servers)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, cluster := range clusters {
+			cluster.Top.Close()
+		}
+	}()
+
+	exp := &exporter{
+		clusters: clusters,
+		textfile: c.Textfile,
+	}
+
+	if err := exp.refresh(); err != nil {
+		return err
+	}
+
+	go func() {
+		for range time.Tick(time.Duration(c.Interval * float64(time.Second))) {
+			if err := exp.refresh(); err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+			}
+		}
+	}()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+
+	listen := c.Listen
+	if listen == "" {
+		if c.Textfile != "" {
+			<-sig
+			return nil
+		}
+		listen = defaultListen
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", exp)
+
+	return listenAndServe(listen, mux, sig)
+}
+
+// listenAndServe serves HTTP requests on addr until a signal arrives on sig.
+func listenAndServe(addr string, handler http.Handler, sig <-chan os.Signal) error {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: httpReadHeaderTimeout,
+		WriteTimeout:      httpWriteTimeout,
+	}
+
+	go func() {
+		<-sig
+		server.Close()
+	}()
+
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// refresh updates the clusters and renders the metrics. Query errors are
+// reported in the metrics, and only errors in writing the textfile are
+// returned.
+func (exp *exporter) refresh() error {
+	if err := qtop.UpdateClusters(exp.clusters); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+	}
+
+	var buf bytes.Buffer
+	if err := qtop.WriteMetrics(&buf, exp.clusters); err != nil {
+		return err
+	}
+
+	exp.mutex.Lock()
+	exp.metrics = buf.Bytes()
+	exp.mutex.Unlock()
+
+	if exp.textfile != "" {
+		return qtop.WriteFileAtomic(exp.textfile, buf.Bytes())
+	}
+	return nil
+}
+
+func (exp *exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	exp.mutex.RLock()
+	metrics := exp.metrics
+	exp.mutex.RUnlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(metrics)
+}
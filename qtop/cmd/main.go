@@ -3,11 +3,16 @@ package main
 import (
 	"errors"
 	"fmt"
+	"net"
 	"os"
 	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/BurntSushi/toml"
 	"github.com/docopt/docopt-go"
 	"github.com/gdamore/tcell"
 
@@ -19,35 +24,299 @@ const usage = `
 Monitor PBS jobs
 
 Usage:
-  qtop [-h] [-t <interval>]
+  qtop [-h] [-t <interval>] [--once [-f <format>] [--table <table>]]
+       [--owner <user>] [--state <states>] [--queue <queue>] [--name <regex>]
+       [--team <team>] [--mine] [--sort <key>] [--group <mode>]
+       [--history <n>]
+       [--proxy <path> | --no-proxy] [--auth-socket <path>]
+       [--record <file> | --replay <file>] [--theme <theme>] [--no-color]
+       [--config <file>] [--print-config] [-s <server>]...
 
 Options:
-  -t <interval>  Specify update interval in seconds [default: 5]
-  -h, --help     Print this help message and exit
+  -t <interval>           Specify update interval in seconds. Defaults to 5
+  -s, --server <server>   Monitor PBS server at host[:port]. Repeat to monitor
+                          multiple servers. Defaults to the active server
+  --once                  Print the summary once and exit
+  -f, --format <format>   Output format of --once: text, json or csv
+                          [default: text]
+  --table <table>         Table to print in csv format: cluster, nodes or jobs
+                          [default: jobs]
+  --owner <user>          Show only the jobs of this user
+  --state <states>        Show only the jobs in these states, separated by
+                          commas (e.g. R,Q)
+  --queue <queue>         Show only the jobs in this queue
+  --name <regex>          Show only the jobs whose name or ID matches this
+                          regular expression
+  --team <team>           Show only the jobs of the members of this team
+                          defined in the configuration file
+  --mine                  Show only your jobs
+  --sort <key>            Sort jobs by owner, name, state, njob, ncpu, cpu,
+                          time, id, qtime, queue, wall or mem
+  --group <mode>          Group jobs by name, array, queue or owner, or none
+  --history <n>           Draw trends of the last n updates, or none if 0.
+                          Defaults to 60
+  --proxy <path>          Get cluster state from qtop proxy listening on this
+                          socket if it is running and owned by root or you.
+                          Defaults to /run/qtop/proxy.sock
+  --no-proxy              Always connect to PBS servers directly
+  --auth-socket <path>    Use trqauthd listening on this socket. Defaults to
+                          /tmp/trqauthd-unix
+  --record <file>         Append every retrieved cluster state to a recording
+                          file
+  --replay <file>         Replay a recording instead of monitoring servers.
+                          Keys: space pause, . and , step, ] and [ speed
+  --theme <theme>         Use colour theme dark, light, high-contrast or mono
+  --no-color              Use no colours, only bold, reverse and other text
+                          attributes. Also enabled by the NO_COLOR variable
+  --config <file>         Read settings from this file instead of
+                          $XDG_CONFIG_HOME/qtop/config.toml
+  --print-config          Print the effective settings and exit
+  -h, --help              Print this help message and exit
+
+Commands:
+  qtop exporter           Serve Prometheus metrics (see qtop exporter -h)
+  qtop serve              Serve JSON API and web dashboard (see qtop serve -h)
+  qtop proxy              Share cluster state among qtop users (see qtop proxy -h)
 `
 
-const minInterval = 1
+const (
+	minInterval        = 1
+	defaultServerPort  = "15001"
+	defaultClusterName = "default"
+)
 
 type config struct {
-	Interval float64 `docopt:"-t"`
+	Interval    float64  `docopt:"-t"`
+	Servers     []string `docopt:"--server"`
+	Once        bool     `docopt:"--once"`
+	Format      string   `docopt:"--format"`
+	Table       string   `docopt:"--table"`
+	Proxy       string   `docopt:"--proxy"`
+	NoProxy     bool     `docopt:"--no-proxy"`
+	AuthSocket  string   `docopt:"--auth-socket"`
+	Record      string   `docopt:"--record"`
+	Replay      string   `docopt:"--replay"`
+	Owner       string   `docopt:"--owner"`
+	States      string   `docopt:"--state"`
+	Queue       string   `docopt:"--queue"`
+	Name        string   `docopt:"--name"`
+	Team        string   `docopt:"--team"`
+	Mine        bool     `docopt:"--mine"`
+	Sort        string   `docopt:"--sort"`
+	Group       string   `docopt:"--group"`
+	History     string   `docopt:"--history"`
+	Theme       string   `docopt:"--theme"`
+	NoColor     bool     `docopt:"--no-color"`
+	ConfigFile  string   `docopt:"--config"`
+	PrintConfig bool     `docopt:"--print-config"`
+}
+
+// configPath returns the path of the configuration file to use.
+func (c *config) configPath() string {
+	if c.ConfigFile != "" {
+		return c.ConfigFile
+	}
+	return qtop.DefaultConfigPath()
+}
+
+// settings returns the effective settings: the configuration file overridden
+// by the command-line options, with defaults filled in.
+func (c *config) settings() (qtop.ConfigFile, error) {
+	path := c.configPath()
+
+	// A missing file is an error only if explicitly specified.
+	if c.ConfigFile != "" {
+		if _, err := os.Stat(path); err != nil {
+			return qtop.ConfigFile{}, err
+		}
+	}
+
+	file, err := qtop.LoadConfigFile(path)
+	if err != nil {
+		return file, err
+	}
+
+	if c.Interval != 0 {
+		file.Interval = time.Duration(c.Interval * float64(time.Second)).String()
+	}
+	if len(c.Servers) > 0 {
+		file.Servers = c.Servers
+	}
+	if c.AuthSocket != "" {
+		file.AuthSocket = c.AuthSocket
+	}
+	if c.Proxy != "" {
+		file.Proxy = c.Proxy
+		file.NoProxy = false
+	}
+	if c.NoProxy {
+		file.NoProxy = true
+	}
+	if c.Group != "" {
+		file.Grouping = c.Group
+	}
+	if c.Sort != "" {
+		file.Sort = c.Sort
+	}
+	if c.History != "" {
+		history, err := strconv.Atoi(c.History)
+		if err != nil {
+			return file, fmt.Errorf("bad history length %q", c.History)
+		}
+		file.History = &history
+	}
+	if c.Theme != "" {
+		file.Theme = c.Theme
+	}
+
+	// See https://no-color.org/
+	if c.NoColor || os.Getenv("NO_COLOR") != "" {
+		file.NoColor = true
+	}
+
+	if file.Filter, err = c.filterExpr(file.Filter); err != nil {
+		return file, err
+	}
+
+	file = file.WithDefaults()
+
+	if err := file.Validate(); err != nil {
+		return file, err
+	}
+
+	return file, nil
+}
+
+// filterExpr returns the filter expression base with the terms given by the
+// filtering options replaced.
+func (c *config) filterExpr(base string) (string, error) {
+	filter, err := qtop.ParseFilter(base)
+	if err != nil {
+		return "", err
+	}
+
+	if c.Owner != "" {
+		filter.Owner = c.Owner
+	}
+
+	if c.States != "" {
+		filter.States = strings.Split(c.States, ",")
+	}
+
+	if c.Queue != "" {
+		filter.Queue = c.Queue
+	}
+
+	if c.Name != "" {
+		re, err := regexp.Compile(c.Name)
+		if err != nil {
+			return "", fmt.Errorf("bad name pattern: %s", err)
+		}
+		filter.Name = re
+	}
+
+	if c.Team != "" {
+		filter.Team = c.Team
+	}
+
+	if c.Mine {
+		filter.Mine = true
+	}
+
+	return filter.String(), nil
 }
 
 func (c *config) validate() error {
-	if c.Interval < minInterval {
+	if c.Interval != 0 && c.Interval < minInterval {
 		return errors.New("update interval is too short")
 	}
+
+	if c.History != "" {
+		if n, err := strconv.Atoi(c.History); err != nil || n < 0 {
+			return errors.New("history length must be a non-negative integer")
+		}
+	}
+
+	switch c.Format {
+	case qtop.FormatText, qtop.FormatJSON, qtop.FormatCSV:
+	default:
+		return fmt.Errorf("unknown format %q", c.Format)
+	}
+
+	switch c.Table {
+	case qtop.TableCluster, qtop.TableNodes, qtop.TableJobs:
+	default:
+		return fmt.Errorf("unknown table %q", c.Table)
+	}
+
 	return nil
 }
 
+// A validator is a command-line configuration that can check itself.
+type validator interface {
+	validate() error
+}
+
 func main() {
+	var err error
+
+	command := ""
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+
+	switch command {
+	case "exporter":
+		var c exporterConfig
+		parseArgs(exporterUsage, &c)
+		err = runExporter(c)
+
+	case "serve":
+		var c serveConfig
+		parseArgs(serveUsage, &c)
+		err = runServe(c)
+
+	case "proxy":
+		var c proxyConfig
+		parseArgs(proxyUsage, &c)
+		err = runProxy(c)
+
+	default:
+		var c config
+		parseArgs(usage, &c)
+
+		switch {
+		case c.PrintConfig:
+			err = printConfig(c)
+		case c.Once:
+			err = runOnce(c)
+		default:
+			err = run(c)
+		}
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+// parseArgs parses command-line arguments into c according to usage. It exits
+// the program if the arguments are invalid.
+func parseArgs(usage string, c validator) {
 	opts, err := docopt.ParseDoc(usage)
 	if err != nil {
 		panic(err)
 	}
 
-	var c config
+	// Commands are implied by the usage.
+	for key := range opts {
+		if !strings.HasPrefix(key, "-") && !strings.HasPrefix(key, "<") {
+			delete(opts, key)
+		}
+	}
 
-	if err := opts.Bind(&c); err != nil {
+	if err := opts.Bind(c); err != nil {
 		fmt.Fprintln(os.Stderr, "option error:", err)
 		os.Exit(64)
 	}
@@ -56,19 +325,23 @@ func main() {
 		fmt.Fprintln(os.Stderr, "option error:", err)
 		os.Exit(64)
 	}
-
-	if err := run(c); err != nil {
-		fmt.Fprintln(os.Stderr, "error:", err)
-		os.Exit(1)
-	}
 }
 
 func run(c config) error {
-	conn, err := torque.Dial()
+	settings, err := c.settings()
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
+
+	interval, _ := settings.RefreshInterval()
+	theme, _ := settings.ColorTheme()
+	keymap, _ := settings.Keymap()
+
+	clusters, player, cleanup, err := loadClusters(c, settings)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
 
 	scr, err := tcell.NewScreen()
 	if err != nil {
@@ -80,19 +353,248 @@ func run(c config) error {
 	}
 	defer scr.Fini()
 
-	top := qtop.NewTop(conn)
-	app := qtop.NewApp(top, scr, qtop.Config{
-		Interval: time.Duration(c.Interval * float64(time.Second)),
+	app := qtop.NewApp(clusters, scr, qtop.Config{
+		Interval:   interval,
+		Player:     player,
+		ConfigPath: c.configPath(),
+		Theme:      theme,
+		Keymap:     keymap,
+		Columns:    settings.Columns,
+		Teams:      settings.Teams,
 	})
 
-	sig := make(chan os.Signal)
+	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
 
+	// The App stops receiving once it quits, so the signals are left to the
+	// default handling while cleaning up.
+	done := make(chan struct{})
 	go func() {
-		for range sig {
+		select {
+		case <-sig:
 			app.Quit()
+		case <-done:
 		}
 	}()
 
-	return app.Start()
+	err = app.Start()
+	signal.Stop(sig)
+	close(done)
+
+	return err
+}
+
+// runOnce prints the summary of the clusters to stdout and returns.
+func runOnce(c config) error {
+	settings, err := c.settings()
+	if err != nil {
+		return err
+	}
+
+	clusters, _, cleanup, err := loadClusters(c, settings)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if err := qtop.UpdateClusters(clusters); err != nil {
+		return err
+	}
+
+	return qtop.WriteSummary(os.Stdout, clusters, c.Format, c.Table)
+}
+
+// printConfig prints the effective settings to stdout in the format of the
+// configuration file.
+func printConfig(c config) error {
+	settings, err := c.settings()
+	if err != nil {
+		return err
+	}
+	return toml.NewEncoder(os.Stdout).Encode(settings)
+}
+
+// loadClusters returns the clusters to monitor, along with the player if
+// replaying a recording, and a function releasing the resources. The clusters
+// are set up to summarize jobs as specified by the settings.
+func loadClusters(c config, settings qtop.ConfigFile) ([]qtop.Cluster, *qtop.Player, func(), error) {
+	torque.DefaultDialer.AuthAddr = settings.AuthSocket
+
+	clusters, player, cleanup, err := openSources(c, settings)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	opts, err := settings.Options()
+	if err != nil {
+		cleanup()
+		return nil, nil, nil, err
+	}
+
+	for _, cluster := range clusters {
+		cluster.Top.SetOptions(opts)
+	}
+
+	return clusters, player, cleanup, nil
+}
+
+// openSources opens the clusters to monitor from a recording or from the PBS
+// servers.
+func openSources(c config, settings qtop.ConfigFile) ([]qtop.Cluster, *qtop.Player, func(), error) {
+	if c.Replay != "" {
+		frames, err := qtop.ReadRecording(c.Replay)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		player, err := qtop.NewPlayer(frames)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		return player.Clusters(), player, func() {}, nil
+	}
+
+	proxyPath := settings.Proxy
+	if settings.NoProxy {
+		proxyPath = ""
+	}
+
+	clusters, err := openClusters(settings.Servers, proxyPath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if c.Record == "" {
+		return clusters, nil, func() { closeClusters(clusters) }, nil
+	}
+
+	rec, err := qtop.OpenRecorder(c.Record)
+	if err != nil {
+		closeClusters(clusters)
+		return nil, nil, nil, err
+	}
+
+	// The recording clusters take over the sources of the original ones, so
+	// they are the ones to close.
+	recorded := qtop.RecordClusters(clusters, rec)
+
+	cleanup := func() {
+		closeClusters(recorded)
+		rec.Close()
+	}
+
+	return recorded, nil, cleanup, nil
+}
+
+// closeClusters closes the Tops of the clusters.
+func closeClusters(clusters []qtop.Cluster) {
+	for _, cluster := range clusters {
+		cluster.Top.Close()
+	}
+}
+
+// openClusters is like dialClusters but uses the qtop proxy listening on the
+// unix socket at proxyPath instead if it serves all the requested clusters.
+func openClusters(servers []string, proxyPath string) ([]qtop.Cluster, error) {
+	if proxyPath != "" {
+		if clusters, ok := proxyClusters(servers, proxyPath); ok {
+			return clusters, nil
+		}
+	}
+	return dialClusters(servers)
+}
+
+// proxyClusters returns clusters retrieving snapshots from the proxy at path.
+// It returns false if the proxy is not running, is not trusted or does not
+// serve any of the servers.
+func proxyClusters(servers []string, path string) ([]qtop.Cluster, bool) {
+	if err := qtop.CheckProxySocket(path); err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Fprintln(os.Stderr, "warning: not using the proxy:", err)
+		}
+		return nil, false
+	}
+
+	names := []string{""}
+	if len(servers) > 0 {
+		names = nil
+		for _, server := range servers {
+			host, _ := splitServer(server)
+			names = append(names, host)
+		}
+	}
+
+	clusters := []qtop.Cluster{}
+
+	for _, name := range names {
+		src := qtop.ProxySource(path, name)
+		if _, err := src.Query(); err != nil {
+			return nil, false
+		}
+
+		if name == "" {
+			name = defaultClusterName
+		}
+
+		clusters = append(clusters, qtop.Cluster{
+			Name: name,
+			Top:  qtop.NewSourceTop(src),
+		})
+	}
+
+	return clusters, true
+}
+
+// dialClusters connects to the given PBS servers. It connects to the active
+// server if no server is given. The clusters reconnect to the servers after
+// failed queries.
+func dialClusters(servers []string) ([]qtop.Cluster, error) {
+	clusters := []qtop.Cluster{}
+
+	if len(servers) == 0 {
+		conn, err := torque.Dial()
+		if err != nil {
+			return nil, err
+		}
+
+		clusters = append(clusters, qtop.Cluster{
+			Name: defaultClusterName,
+			Top:  qtop.NewSourceTop(qtop.RedialSource(conn, torque.Dial)),
+		})
+		return clusters, nil
+	}
+
+	for _, server := range servers {
+		host, addr := splitServer(server)
+
+		conn, err := torque.DefaultDialer.Dial(addr)
+		if err != nil {
+			for _, cluster := range clusters {
+				cluster.Top.Close()
+			}
+			return nil, fmt.Errorf("%s: %s", server, err)
+		}
+
+		dial := func() (torque.Conn, error) {
+			return torque.DefaultDialer.Dial(addr)
+		}
+
+		clusters = append(clusters, qtop.Cluster{
+			Name: host,
+			Top:  qtop.NewSourceTop(qtop.RedialSource(conn, dial)),
+		})
+	}
+
+	return clusters, nil
+}
+
+// splitServer returns the host name and the address with port of a server
+// given as host[:port].
+func splitServer(server string) (string, string) {
+	host, port, err := net.SplitHostPort(server)
+	if err != nil {
+		host, port = server, defaultServerPort
+	}
+	return host, net.JoinHostPort(host, port)
 }
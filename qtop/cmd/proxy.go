@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/snsinfu/torque-qtop/qtop"
+)
+
+const proxyUsage = `
+Poll PBS servers and share the cluster state with qtop clients
+
+Usage:
+  qtop proxy [-h] [-t <interval>] [--socket <path>] [-s <server>]...
+
+Options:
+  -t <interval>           Specify update interval in seconds [default: 5]
+  -s, --server <server>   Monitor PBS server at host[:port]. Repeat to monitor
+                          multiple servers. Defaults to the active server
+  --socket <path>         Listen on this unix socket
+                          [default: /run/qtop/proxy.sock]
+  -h, --help              Print this help message and exit
+
+qtop uses the proxy automatically when the socket exists and is owned by root
+or by the user running qtop. The socket is accessible by all users on the host,
+so run the proxy as root, or let the users choose it with --proxy.
+`
+
+type proxyConfig struct {
+	Interval float64  `docopt:"-t"`
+	Servers  []string `docopt:"--server"`
+	Socket   string   `docopt:"--socket"`
+}
+
+func (c *proxyConfig) validate() error {
+	if c.Interval < minInterval {
+		return errors.New("update interval is too short")
+	}
+	return nil
+}
+
+// runProxy serves cluster snapshots on a unix socket until the program is
+// terminated.
+func runProxy(c proxyConfig) error {
+	clusters, err := dialClusters(c.Servers)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, cluster := range clusters {
+			cluster.Top.Close()
+		}
+	}()
+
+	proxy := qtop.NewProxy(clusters)
+	if err := proxy.Refresh(); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+	}
+
+	ln, err := listenUnix(c.Socket)
+	if err != nil {
+		return err
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		<-sig
+		ln.Close()
+	}()
+
+	go func() {
+		for range time.Tick(time.Duration(c.Interval * float64(time.Second))) {
+			if err := proxy.Refresh(); err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+			}
+		}
+	}()
+
+	proxy.Serve(ln)
+	return nil
+}
+
+// listenUnix listens on a world-accessible unix socket at path, creating the
+// directory if needed. It replaces a stale socket file left by a dead proxy.
+func listenUnix(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("another proxy is listening on %s", path)
+	}
+	os.Remove(path)
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, 0666); err != nil {
+		ln.Close()
+		return nil, err
+	}
+
+	return ln, nil
+}
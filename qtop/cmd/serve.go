@@ -0,0 +1,333 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/snsinfu/torque-qtop/qtop"
+	"github.com/snsinfu/torque-qtop/torque"
+)
+
+const serveUsage = `
+Serve PBS cluster status over HTTP as JSON and a web dashboard
+
+Usage:
+  qtop serve [-h] [-t <interval>] [--listen <address>] [-s <server>]...
+
+Options:
+  -t <interval>           Specify update interval in seconds [default: 5]
+  -s, --server <server>   Monitor PBS server at host[:port]. Repeat to monitor
+                          multiple servers. Defaults to the active server
+  --listen <address>      Listen on this address [default: :8750]
+  -h, --help              Print this help message and exit
+
+API:
+  GET /                   Web dashboard
+  GET /api/summary        Summaries of the clusters
+  GET /api/jobs           Raw jobs
+  GET /api/nodes          Raw nodes
+
+  The API endpoints accept query parameters cluster, owner, state, queue and
+  name (regular expression) to filter the results. state takes a list of job or
+  node states separated by commas. queue applies only to jobs.
+`
+
+type serveConfig struct {
+	Interval float64  `docopt:"-t"`
+	Servers  []string `docopt:"--server"`
+	Listen   string   `docopt:"--listen"`
+}
+
+func (c *serveConfig) validate() error {
+	if c.Interval < minInterval {
+		return errors.New("update interval is too short")
+	}
+	return nil
+}
+
+// clusterState is a copy of the latest state of a cluster. It is safe to read
+// while the cluster is being updated.
+type clusterState struct {
+	Name     string
+	Summary  *qtop.Summary
+	Snapshot *qtop.Snapshot
+}
+
+// server periodically queries the clusters and serves the latest states.
+type server struct {
+	clusters []qtop.Cluster
+	interval time.Duration
+	mutex    sync.RWMutex
+	states   []clusterState
+}
+
+// runServe serves the cluster states over HTTP until the program is
+// terminated.
+func runServe(c serveConfig) error {
+	clusters, err := dialClusters(c.Servers)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, cluster := range clusters {
+			cluster.Top.Close()
+		}
+	}()
+
+	srv := &server{
+		clusters: clusters,
+		interval: time.Duration(c.Interval * float64(time.Second)),
+	}
+	srv.refresh()
+
+	go func() {
+		for range time.Tick(srv.interval) {
+			srv.refresh()
+		}
+	}()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", srv.serveDashboard)
+	mux.HandleFunc("/api/summary", srv.serveSummary)
+	mux.HandleFunc("/api/jobs", srv.serveJobs)
+	mux.HandleFunc("/api/nodes", srv.serveNodes)
+
+	return listenAndServe(c.Listen, mux, sig)
+}
+
+// refresh updates the clusters and publishes the new states.
+func (srv *server) refresh() {
+	if err := qtop.UpdateClusters(srv.clusters); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+	}
+
+	states := []clusterState{}
+	for _, cluster := range srv.clusters {
+		states = append(states, clusterState{
+			Name:     cluster.Name,
+			Summary:  cluster.Top.Current(),
+			Snapshot: cluster.Top.Snapshot(),
+		})
+	}
+
+	srv.mutex.Lock()
+	srv.states = states
+	srv.mutex.Unlock()
+}
+
+// query returns the current states of the clusters selected by the cluster
+// query parameter.
+func (srv *server) query(q queryFilter) []clusterState {
+	srv.mutex.RLock()
+	defer srv.mutex.RUnlock()
+
+	states := []clusterState{}
+	for _, state := range srv.states {
+		if state.Summary != nil && q.matchCluster(state.Name) {
+			states = append(states, state)
+		}
+	}
+	return states
+}
+
+func (srv *server) serveDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, dashboardHTML, srv.interval.Nanoseconds()/int64(time.Millisecond))
+}
+
+func (srv *server) serveSummary(w http.ResponseWriter, r *http.Request) {
+	q, err := parseQueryFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	type clusterSummary struct {
+		Name string `json:"name"`
+		qtop.Summary
+	}
+	out := []clusterSummary{}
+
+	for _, state := range srv.query(q) {
+		sum := *state.Summary
+
+		sum.Jobs = []qtop.JobSummary{}
+		for _, job := range state.Summary.Jobs {
+			if q.matchJob(job.Owner, job.State, job.Queue, job.Name) {
+				sum.Jobs = append(sum.Jobs, job)
+			}
+		}
+
+		out = append(out, clusterSummary{Name: state.Name, Summary: sum})
+	}
+
+	writeJSON(w, map[string]interface{}{"clusters": out})
+}
+
+func (srv *server) serveJobs(w http.ResponseWriter, r *http.Request) {
+	q, err := parseQueryFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	type clusterJobs struct {
+		Name string       `json:"name"`
+		Time time.Time    `json:"time"`
+		Jobs []torque.Job `json:"jobs"`
+	}
+	out := []clusterJobs{}
+
+	for _, state := range srv.query(q) {
+		jobs := []torque.Job{}
+		for _, job := range state.Snapshot.Jobs {
+			if q.matchJob(job.Owner, job.State, job.Queue, job.Name) {
+				jobs = append(jobs, job)
+			}
+		}
+
+		out = append(out, clusterJobs{
+			Name: state.Name,
+			Time: state.Snapshot.Time,
+			Jobs: jobs,
+		})
+	}
+
+	writeJSON(w, map[string]interface{}{"clusters": out})
+}
+
+func (srv *server) serveNodes(w http.ResponseWriter, r *http.Request) {
+	q, err := parseQueryFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	type clusterNodes struct {
+		Name  string        `json:"name"`
+		Time  time.Time     `json:"time"`
+		Nodes []torque.Node `json:"nodes"`
+	}
+	out := []clusterNodes{}
+
+	for _, state := range srv.query(q) {
+		nodes := []torque.Node{}
+		for _, node := range state.Snapshot.Nodes {
+			if q.matchNode(node.Name, node.State) {
+				nodes = append(nodes, node)
+			}
+		}
+
+		out = append(out, clusterNodes{
+			Name:  state.Name,
+			Time:  state.Snapshot.Time,
+			Nodes: nodes,
+		})
+	}
+
+	writeJSON(w, map[string]interface{}{"clusters": out})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// queryFilter holds the filtering query parameters of an API request. Empty
+// fields match anything.
+type queryFilter struct {
+	cluster string
+	owner   string
+	states  []string
+	queue   string
+	name    *regexp.Regexp
+}
+
+func parseQueryFilter(r *http.Request) (queryFilter, error) {
+	params := r.URL.Query()
+
+	q := queryFilter{
+		cluster: params.Get("cluster"),
+		owner:   params.Get("owner"),
+		queue:   params.Get("queue"),
+	}
+
+	if states := params.Get("state"); states != "" {
+		q.states = strings.Split(states, ",")
+	}
+
+	if name := params.Get("name"); name != "" {
+		re, err := regexp.Compile(name)
+		if err != nil {
+			return q, fmt.Errorf("bad name pattern: %s", err)
+		}
+		q.name = re
+	}
+
+	return q, nil
+}
+
+func (q queryFilter) matchCluster(name string) bool {
+	return q.cluster == "" || q.cluster == name
+}
+
+// matchJob tests if a job matches the filter. owner may or may not have the
+// host part. queue may list the queues of a job group separated by commas.
+func (q queryFilter) matchJob(owner, state, queue, name string) bool {
+	if q.owner != "" && q.owner != owner && !strings.HasPrefix(owner, q.owner+"@") {
+		return false
+	}
+
+	if q.queue != "" && !q.matchQueue(queue) {
+		return false
+	}
+
+	return q.matchState(state) && q.matchName(name)
+}
+
+func (q queryFilter) matchQueue(queues string) bool {
+	for _, queue := range strings.Split(queues, ",") {
+		if queue == q.queue {
+			return true
+		}
+	}
+	return false
+}
+
+func (q queryFilter) matchNode(name, state string) bool {
+	return q.matchState(state) && q.matchName(name)
+}
+
+func (q queryFilter) matchState(state string) bool {
+	if len(q.states) == 0 {
+		return true
+	}
+
+	for _, s := range q.states {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+func (q queryFilter) matchName(name string) bool {
+	return q.name == nil || q.name.MatchString(name)
+}
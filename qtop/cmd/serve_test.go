@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/snsinfu/torque-qtop/qtop"
+	"github.com/snsinfu/torque-qtop/torque"
+)
+
+func newTestServer() *server {
+	return &server{
+		states: []clusterState{{
+			Name: "alpha",
+			Summary: &qtop.Summary{
+				Jobs: []qtop.JobSummary{
+					{Name: "relax", Owner: "alice@login", State: "R", Queue: "batch"},
+					{Name: "sim", Owner: "bob@login", State: "R", Queue: "batch,long"},
+					{Name: "sweep", Owner: "dave@login", State: "Q", Queue: "long"},
+				},
+			},
+			Snapshot: &qtop.Snapshot{
+				Jobs: []torque.Job{
+					{ID: "1.server", Name: "relax", Owner: "alice@login", State: "R", Queue: "batch"},
+					{ID: "2.server", Name: "sweep", Owner: "dave@login", State: "Q", Queue: "long"},
+				},
+			},
+		}},
+	}
+}
+
+func Test_server_serveSummary_FiltersJobs(t *testing.T) {
+	testCases := []struct {
+		query string
+		names []string
+	}{
+		{"", []string{"relax", "sim", "sweep"}},
+		{"owner=bob", []string{"sim"}},
+		{"state=Q", []string{"sweep"}},
+		{"name=^s", []string{"sim", "sweep"}},
+		{"queue=long", []string{"sim", "sweep"}},
+		{"queue=batch&state=R", []string{"relax", "sim"}},
+		{"queue=debug", []string{}},
+	}
+
+	srv := newTestServer()
+
+	for _, tc := range testCases {
+		rec := httptest.NewRecorder()
+		srv.serveSummary(rec, httptest.NewRequest("GET", "/api/summary?"+tc.query, nil))
+
+		var out struct {
+			Clusters []struct {
+				Jobs []qtop.JobSummary `json:"jobs"`
+			} `json:"clusters"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&out); err != nil {
+			t.Fatalf("%q: %s", tc.query, err)
+		}
+		if len(out.Clusters) != 1 {
+			t.Fatalf("%q: unexpected clusters: %+v", tc.query, out.Clusters)
+		}
+
+		names := []string{}
+		for _, job := range out.Clusters[0].Jobs {
+			names = append(names, job.Name)
+		}
+		if !equalStrings(names, tc.names) {
+			t.Errorf("%q: got jobs %v, want %v", tc.query, names, tc.names)
+		}
+	}
+}
+
+func Test_server_serveJobs_FiltersByQueue(t *testing.T) {
+	srv := newTestServer()
+
+	rec := httptest.NewRecorder()
+	srv.serveJobs(rec, httptest.NewRequest("GET", "/api/jobs?queue=long", nil))
+
+	var out struct {
+		Clusters []struct {
+			Jobs []torque.Job `json:"jobs"`
+		} `json:"clusters"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Clusters) != 1 || len(out.Clusters[0].Jobs) != 1 || out.Clusters[0].Jobs[0].ID != "2.server" {
+		t.Errorf("unexpected jobs: %+v", out.Clusters)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,398 @@
+package qtop
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A jobRow is a job group drawn in a row of the job list.
+type jobRow struct {
+	job JobSummary
+
+	// now is the time of the snapshot the group is taken from.
+	now time.Time
+
+	// mine is true if the group is owned by the current user.
+	mine bool
+
+	// trend is the CPU usage of the group in the recent summaries, oldest
+	// first.
+	trend []float64
+}
+
+// A jobColumn is a column of the job list.
+type jobColumn struct {
+	name  string
+	label string
+
+	// width is the number of screen columns, or the minimum number if the
+	// column is flexible.
+	width int
+
+	// flex is the share of the space left on the screen taken by a flexible
+	// column. Fixed columns have zero flex.
+	flex int
+
+	right bool
+	key   SortKey
+
+	// tail is true if the end of a long value is shown instead of the start.
+	tail bool
+
+	// value formats the cell of a row.
+	value func(row jobRow) string
+
+	// role, if not nil, returns the style role of the cell of a row.
+	role func(row jobRow) string
+}
+
+// jobColumns lists all the columns of the job list.
+var jobColumns = []jobColumn{
+	{
+		name:  "user",
+		label: "USER",
+		width: 10,
+		key:   SortOwner,
+		value: func(row jobRow) string { return abbrevUsername(row.job.Owner) },
+		role:  dimUnlessMine(""),
+	},
+	{
+		name:  "job",
+		label: "JOB",
+		width: 20,
+		flex:  2,
+		key:   SortName,
+		value: func(row jobRow) string { return row.job.Name },
+	},
+	{
+		name:  "state",
+		label: "S",
+		width: 1,
+		key:   SortState,
+		value: func(row jobRow) string { return row.job.State },
+		role:  func(row jobRow) string { return stateRole(row.job.State) },
+	},
+	{
+		name:  "queue",
+		label: "QUEUE",
+		width: 8,
+		key:   SortQueue,
+		value: func(row jobRow) string { return row.job.Queue },
+	},
+	{
+		name:  "njob",
+		label: "NJOB",
+		width: 4,
+		right: true,
+		key:   SortCount,
+		value: func(row jobRow) string { return fmt.Sprint(row.job.Count) },
+	},
+	{
+		name:  "ncpu",
+		label: "NCPU",
+		width: 4,
+		right: true,
+		key:   SortOccupancy,
+		value: func(row jobRow) string { return fmt.Sprint(row.job.Occupancy) },
+	},
+	{
+		name:  "cpu",
+		label: "CPU%",
+		width: 6,
+		right: true,
+		key:   SortCPUUsage,
+		value: func(row jobRow) string { return fmt.Sprintf("%.1f", row.job.CPUUsage*100) },
+	},
+	{
+		name:  "trend",
+		label: "TREND",
+		width: 8,
+		tail:  true,
+		key:   sortNone,
+		value: func(row jobRow) string {
+			// The usage is the mean over the jobs of the group, so it is
+			// scaled against the slots of a job.
+			cores := float64(row.job.Occupancy)
+			if row.job.Count > 0 {
+				cores /= float64(row.job.Count)
+			}
+			max := math.Max(seriesMax(row.trend), cores)
+			return sparkline(row.trend, max, len(row.trend))
+		},
+		role: func(row jobRow) string { return roleTrend },
+	},
+	{
+		name:  "mem",
+		label: "MEM",
+		width: 6,
+		right: true,
+		key:   SortMemory,
+		value: func(row jobRow) string { return formatBytes(row.job.Memory) },
+	},
+	{
+		name:  "time",
+		label: "MAX TIME",
+		width: 9,
+		right: true,
+		key:   SortMaxWalltime,
+		value: func(row jobRow) string { return formatClock(row.job.MaxWalltime) },
+	},
+	{
+		name:  "wall",
+		label: "REQ TIME",
+		width: 9,
+		right: true,
+		key:   SortRequestedWalltime,
+		value: func(row jobRow) string {
+			if row.job.RequestedWalltime == 0 {
+				return ""
+			}
+			return formatClock(row.job.RequestedWalltime)
+		},
+	},
+	{
+		name:  "wait",
+		label: "WAIT",
+		width: 9,
+		right: true,
+		key:   sortNone,
+		value: func(row jobRow) string {
+			wait := waitTime(row.job, row.now)
+			if wait < 0 {
+				return ""
+			}
+			return formatClock(wait)
+		},
+	},
+	{
+		name:  "exit",
+		label: "EXIT",
+		width: 4,
+		key:   sortNone,
+		value: func(row jobRow) string { return row.job.ExitStatus },
+		role: func(row jobRow) string {
+			if row.job.ExitStatus != "" && row.job.ExitStatus != "0" {
+				return roleNotice
+			}
+			return ""
+		},
+	},
+	{
+		name:  "account",
+		label: "ACCOUNT",
+		width: 10,
+		key:   sortNone,
+		value: func(row jobRow) string { return row.job.Account },
+	},
+	{
+		name:  "jid",
+		label: "JID",
+		width: 3,
+		flex:  3,
+		key:   SortID,
+		value: func(row jobRow) string { return compressIDs(row.job.IDs) },
+		role:  dimUnlessMine(roleJID),
+	},
+}
+
+// defaultColumnNames lists the columns shown by default.
+var defaultColumnNames = []string{
+	"user", "job", "state", "njob", "ncpu", "cpu", "time", "jid",
+}
+
+// defaultColumns returns the default columns with the trend column after the
+// CPU usage if history summaries are kept.
+func defaultColumns(history int) []string {
+	cols := []string{}
+	for _, name := range defaultColumnNames {
+		cols = append(cols, name)
+		if name == "cpu" && history > 0 {
+			cols = append(cols, "trend")
+		}
+	}
+	return cols
+}
+
+// dimUnlessMine returns a role function giving role to the current user's
+// jobs and the dim role to the others.
+func dimUnlessMine(role string) func(jobRow) string {
+	return func(row jobRow) string {
+		if !row.mine {
+			return roleDim
+		}
+		return role
+	}
+}
+
+// stateRole returns the style role of a job state.
+func stateRole(state string) string {
+	switch state {
+	case "R":
+		return roleRunning
+	case "C", "E":
+		return roleDone
+	case "H", "Q", "T", "W":
+		return roleWaiting
+	}
+	return ""
+}
+
+// waitTime returns the number of seconds the longest waiting job of a group
+// has been in the queue at now, or -1 if the group is not waiting.
+func waitTime(job JobSummary, now time.Time) int {
+	if stateRole(job.State) != roleWaiting || job.QueueTime == 0 || now.IsZero() {
+		return -1
+	}
+
+	wait := now.Unix() - job.QueueTime
+	if wait < 0 {
+		wait = 0
+	}
+	return int(wait)
+}
+
+// JobColumnNames returns the names of all the columns of the job list.
+func JobColumnNames() []string {
+	names := []string{}
+	for _, col := range jobColumns {
+		names = append(names, col.name)
+	}
+	return names
+}
+
+// ValidateColumns checks column specs of the form "name[:width]".
+func ValidateColumns(specs []string) error {
+	for _, spec := range specs {
+		if _, err := parseColumnSpec(spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseColumnSpec returns the column specified by "name[:width]". A column
+// given a width is fixed at the width.
+func parseColumnSpec(spec string) (jobColumn, error) {
+	name, width := spec, ""
+	sized := false
+	if n := strings.Index(spec, ":"); n != -1 {
+		name, width, sized = spec[:n], spec[n+1:], true
+	}
+
+	col, ok := findJobColumn(name)
+	if !ok {
+		return col, fmt.Errorf(
+			"unknown column %q (columns: %s)",
+			name,
+			strings.Join(JobColumnNames(), ", "),
+		)
+	}
+
+	if sized {
+		n, err := strconv.Atoi(width)
+		if err != nil || n < 1 {
+			return col, fmt.Errorf("bad width of column %s: %q", name, width)
+		}
+		col.width = n
+		col.flex = 0
+	}
+
+	return col, nil
+}
+
+// formatColumnSpec returns the spec of a column, with the width if it differs
+// from the default.
+func formatColumnSpec(col jobColumn) string {
+	def, _ := findJobColumn(col.name)
+	if col.width == def.width && col.flex == def.flex {
+		return col.name
+	}
+	return fmt.Sprintf("%s:%d", col.name, col.width)
+}
+
+func findJobColumn(name string) (jobColumn, bool) {
+	for _, col := range jobColumns {
+		if col.name == name {
+			return col, true
+		}
+	}
+	return jobColumn{}, false
+}
+
+// selectJobColumns returns the columns given by specs in the order of specs,
+// or the default columns if specs is empty. Invalid specs are ignored.
+func selectJobColumns(specs []string) []jobColumn {
+	if len(specs) == 0 {
+		specs = defaultColumnNames
+	}
+
+	cols := []jobColumn{}
+	for _, spec := range specs {
+		if col, err := parseColumnSpec(spec); err == nil {
+			cols = append(cols, col)
+		}
+	}
+	return cols
+}
+
+// layoutColumns returns the widths of columns on a screen of width w. The
+// flexible columns share the space left by the others in proportion to their
+// flex.
+func layoutColumns(cols []jobColumn, w int) []int {
+	widths := make([]int, len(cols))
+
+	avail := w - 2*xMargin - (len(cols) - 1)
+	flex := 0
+	for i, col := range cols {
+		widths[i] = col.width
+		avail -= col.width
+		flex += col.flex
+	}
+
+	if avail <= 0 || flex == 0 {
+		return widths
+	}
+
+	last := 0
+	left := avail
+	for i, col := range cols {
+		if col.flex == 0 {
+			continue
+		}
+		extra := avail * col.flex / flex
+		widths[i] += extra
+		left -= extra
+		last = i
+	}
+	widths[last] += left
+
+	return widths
+}
+
+// formatBytes formats a size in bytes in a short form like "1.5G".
+func formatBytes(n int64) string {
+	if n == 0 {
+		return ""
+	}
+
+	const units = "KMGTP"
+
+	if n < 1024 {
+		return fmt.Sprintf("%dB", n)
+	}
+
+	size := float64(n)
+	unit := -1
+	for size >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+
+	if size < 10 {
+		return fmt.Sprintf("%.1f%c", size, units[unit])
+	}
+	return fmt.Sprintf("%.0f%c", size, units[unit])
+}
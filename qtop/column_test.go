@@ -0,0 +1,138 @@
+package qtop
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_ValidateColumns(t *testing.T) {
+	if err := ValidateColumns([]string{"user", "jid", "cpu"}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	if err := ValidateColumns([]string{"user", "memory"}); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func Test_selectJobColumns_KeepsOrder(t *testing.T) {
+	cols := selectJobColumns([]string{"jid", "user"})
+
+	if len(cols) != 2 || cols[0].name != "jid" || cols[1].name != "user" {
+		t.Errorf("unexpected columns: %+v", cols)
+	}
+
+	if len(selectJobColumns(nil)) != len(defaultColumnNames) {
+		t.Error("default columns are not selected")
+	}
+}
+
+func Test_defaultColumns_AddsTrendWithHistory(t *testing.T) {
+	if cols := defaultColumns(0); containsString(cols, "trend") {
+		t.Errorf("trend column without history: %v", cols)
+	}
+
+	cols := defaultColumns(defaultHistory)
+	if len(cols) != len(defaultColumnNames)+1 || cols[6] != "trend" {
+		t.Errorf("unexpected columns: %v", cols)
+	}
+}
+
+func Test_trendColumn_ScalesPerJob(t *testing.T) {
+	col, _ := findJobColumn("trend")
+
+	row := jobRow{
+		job:   JobSummary{Count: 2, Occupancy: 8},
+		trend: []float64{4, 2},
+	}
+	if actual := col.value(row); actual != "█▅" {
+		t.Errorf("unexpected trend: %q", actual)
+	}
+}
+
+func Test_parseColumnSpec_FixesWidth(t *testing.T) {
+	col, err := parseColumnSpec("job:30")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if col.width != 30 || col.flex != 0 {
+		t.Errorf("unexpected width: %d (flex %d)", col.width, col.flex)
+	}
+
+	if spec := formatColumnSpec(col); spec != "job:30" {
+		t.Errorf("unexpected spec: %q", spec)
+	}
+
+	for _, spec := range []string{"job:", "job:0", "job:x"} {
+		if _, err := parseColumnSpec(spec); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+}
+
+func Test_layoutColumns_FillsScreen(t *testing.T) {
+	cols := selectJobColumns([]string{"user", "job", "njob", "jid"})
+
+	widths := layoutColumns(cols, 80)
+
+	total := 2*xMargin + len(cols) - 1
+	for _, w := range widths {
+		total += w
+	}
+	if total != 80 {
+		t.Errorf("columns take %d screen columns: %v", total, widths)
+	}
+
+	if widths[0] != 10 || widths[2] != 4 {
+		t.Errorf("fixed columns are resized: %v", widths)
+	}
+
+	// The space left is shared 2:3 by job and jid.
+	if widths[1] != 20+36*2/5 {
+		t.Errorf("unexpected width of job column: %d", widths[1])
+	}
+}
+
+func Test_layoutColumns_KeepsMinimumWidths(t *testing.T) {
+	cols := selectJobColumns(nil)
+
+	for i, w := range layoutColumns(cols, 40) {
+		if w != cols[i].width {
+			t.Errorf("%s: unexpected width %d", cols[i].name, w)
+		}
+	}
+}
+
+func Test_formatBytes(t *testing.T) {
+	testCases := []struct {
+		n    int64
+		want string
+	}{
+		{0, ""},
+		{512, "512B"},
+		{1536, "1.5K"},
+		{300 << 20, "300M"},
+		{5 << 40, "5.0T"},
+	}
+
+	for _, tc := range testCases {
+		if actual := formatBytes(tc.n); actual != tc.want {
+			t.Errorf("%d: got %q, want %q", tc.n, actual, tc.want)
+		}
+	}
+}
+
+func Test_waitTime(t *testing.T) {
+	now := time.Unix(1500000100, 0)
+
+	waiting := JobSummary{State: "Q", QueueTime: 1500000000}
+	if wait := waitTime(waiting, now); wait != 100 {
+		t.Errorf("unexpected wait time: %d", wait)
+	}
+
+	running := JobSummary{State: "R", QueueTime: 1500000000}
+	if wait := waitTime(running, now); wait != -1 {
+		t.Errorf("running job is waiting: %d", wait)
+	}
+}
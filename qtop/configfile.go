@@ -0,0 +1,493 @@
+package qtop
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/snsinfu/torque-qtop/torque"
+)
+
+// Default settings not specified in the configuration file.
+const (
+	defaultInterval = "5s"
+	minInterval     = time.Second
+)
+
+// A ConfigFile is the content of a configuration file in TOML.
+type ConfigFile struct {
+	// Interval is the refresh interval like "5s".
+	Interval string `toml:"interval"`
+
+	// Servers lists PBS servers to monitor as host[:port]. The active server
+	// is monitored if empty.
+	Servers []string `toml:"servers,omitempty"`
+
+	// AuthSocket is the unix socket of trqauthd.
+	AuthSocket string `toml:"auth_socket"`
+
+	// Proxy is the unix socket of the qtop proxy used if it is running.
+	Proxy string `toml:"proxy"`
+
+	// NoProxy disables the proxy.
+	NoProxy bool `toml:"no_proxy"`
+
+	// Grouping is the name of the group mode of jobs.
+	Grouping string `toml:"grouping"`
+
+	// GroupPattern is a regular expression matching the part of job names
+	// removed in the name group mode.
+	GroupPattern string `toml:"group_pattern,omitempty"`
+
+	// Sort is the name of the sort key of the job list.
+	Sort string `toml:"sort"`
+
+	// SortDescending reverses the order of the job list.
+	SortDescending bool `toml:"sort_descending"`
+
+	// Filter is a filter expression accepted by ParseFilter.
+	Filter string `toml:"filter,omitempty"`
+
+	// Columns lists the columns shown in the job list as "name[:width]".
+	Columns []string `toml:"columns"`
+
+	// History is the number of updates kept for the trend sparklines. Zero
+	// disables the trends, and nil means the default.
+	History *int `toml:"history"`
+
+	// Theme is the name of the built-in theme.
+	Theme string `toml:"theme"`
+
+	// NoColor disables colours, keeping only text attributes of the styles.
+	NoColor bool `toml:"no_color"`
+
+	// Colors maps style roles to styles overriding the theme, in the form
+	// accepted by ParseStyle.
+	Colors map[string]string `toml:"colors"`
+
+	// Keys maps actions to space-separated key names.
+	Keys map[string]string `toml:"keys"`
+
+	// Teams maps team names to the usernames of the members.
+	Teams map[string][]string `toml:"teams,omitempty"`
+}
+
+// DefaultConfigPath returns the path of the configuration file, which is
+// qtop/config.toml in $XDG_CONFIG_HOME or ~/.config.
+func DefaultConfigPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "qtop", "config.toml")
+}
+
+// LoadConfigFile reads a configuration file. It returns an empty ConfigFile if
+// the file does not exist.
+func LoadConfigFile(path string) (ConfigFile, error) {
+	var file ConfigFile
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return file, nil
+	}
+
+	meta, err := toml.DecodeFile(path, &file)
+	if err != nil {
+		return file, fmt.Errorf("%s: %s", path, err)
+	}
+
+	if keys := meta.Undecoded(); len(keys) > 0 {
+		return file, fmt.Errorf("%s: unknown setting %q", path, keys[0].String())
+	}
+
+	return file, nil
+}
+
+// WithDefaults returns the file with the settings it does not specify set to
+// the defaults. Colours and keys are merged with the defaults role by role and
+// action by action.
+func (file ConfigFile) WithDefaults() ConfigFile {
+	if file.Interval == "" {
+		file.Interval = defaultInterval
+	}
+	if file.AuthSocket == "" {
+		file.AuthSocket = torque.DefaultDialer.AuthAddr
+	}
+	if file.Proxy == "" {
+		file.Proxy = DefaultProxySocket
+	}
+	if file.Grouping == "" {
+		file.Grouping = GroupByName.String()
+	}
+	if file.Sort == "" {
+		file.Sort = SortOwner.String()
+	}
+	if file.History == nil {
+		history := defaultHistory
+		file.History = &history
+	}
+	if len(file.Columns) == 0 {
+		file.Columns = defaultColumns(*file.History)
+	}
+	if file.Theme == "" {
+		file.Theme = DefaultTheme
+	}
+
+	colors := map[string]string{}
+	if theme, err := file.baseTheme(); err == nil {
+		colors = theme.Styles.Specs()
+	}
+	for role, spec := range file.Colors {
+		colors[role] = spec
+	}
+	file.Colors = colors
+
+	keys := DefaultKeymap().Bindings()
+	for action, names := range file.Keys {
+		keys[action] = names
+	}
+	file.Keys = keys
+
+	return file
+}
+
+// Validate checks all the settings in the file.
+func (file ConfigFile) Validate() error {
+	if _, err := file.RefreshInterval(); err != nil {
+		return err
+	}
+	if _, err := file.Options(); err != nil {
+		return err
+	}
+	if _, err := file.ColorTheme(); err != nil {
+		return err
+	}
+	if _, err := file.Keymap(); err != nil {
+		return err
+	}
+	return ValidateColumns(file.Columns)
+}
+
+// RefreshInterval returns the refresh interval specified in the file, or the
+// default interval if not specified.
+func (file ConfigFile) RefreshInterval() (time.Duration, error) {
+	spec := file.Interval
+	if spec == "" {
+		spec = defaultInterval
+	}
+
+	interval, err := time.ParseDuration(spec)
+	if err != nil {
+		return 0, fmt.Errorf("bad interval: %s", err)
+	}
+
+	if interval < minInterval {
+		return 0, fmt.Errorf("interval %s is too short", interval)
+	}
+
+	return interval, nil
+}
+
+// Options returns the summarizing options specified in the file.
+func (file ConfigFile) Options() (Options, error) {
+	var opts Options
+	var err error
+
+	if opts.Grouping, err = file.JobGrouping(); err != nil {
+		return opts, err
+	}
+
+	if opts.Order, err = file.JobOrder(); err != nil {
+		return opts, err
+	}
+
+	if opts.Filter, err = file.JobFilter(); err != nil {
+		return opts, err
+	}
+
+	opts.History = defaultHistory
+	if file.History != nil {
+		if *file.History < 0 {
+			return opts, fmt.Errorf("bad history length %d", *file.History)
+		}
+		opts.History = *file.History
+	}
+
+	return opts, nil
+}
+
+// JobGrouping returns the grouping of jobs specified in the file.
+func (file ConfigFile) JobGrouping() (Grouping, error) {
+	var grouping Grouping
+
+	if file.Grouping != "" {
+		mode, err := ParseGroupMode(file.Grouping)
+		if err != nil {
+			return grouping, err
+		}
+		grouping.Mode = mode
+	}
+
+	if file.GroupPattern != "" {
+		re, err := regexp.Compile(file.GroupPattern)
+		if err != nil {
+			return grouping, fmt.Errorf("bad group pattern: %s", err)
+		}
+		grouping.Pattern = re
+	}
+
+	return grouping, nil
+}
+
+// JobOrder returns the order of jobs specified in the file.
+func (file ConfigFile) JobOrder() (JobOrder, error) {
+	order := JobOrder{Descending: file.SortDescending}
+
+	if file.Sort != "" {
+		key, err := ParseSortKey(file.Sort)
+		if err != nil {
+			return order, err
+		}
+		order.Key = key
+	}
+
+	return order, nil
+}
+
+// JobFilter returns the filter of jobs specified in the file, with the members
+// of the team resolved from the teams in the file.
+func (file ConfigFile) JobFilter() (Filter, error) {
+	filter, err := ParseFilter(file.Filter)
+	if err != nil {
+		return filter, err
+	}
+	return filter.WithTeams(file.Teams)
+}
+
+// ColorTheme returns the theme specified in the file with the styles
+// overridden by the colours in the file. Colours are removed if NoColor is set.
+func (file ConfigFile) ColorTheme() (Theme, error) {
+	theme, err := file.baseTheme()
+	if err != nil {
+		return theme, err
+	}
+
+	if err := theme.Styles.Override(file.Colors); err != nil {
+		return theme, err
+	}
+
+	if file.NoColor {
+		theme = theme.Monochrome()
+	}
+
+	return theme, nil
+}
+
+// baseTheme returns the built-in theme the colours in the file are applied to.
+// The monochrome theme is used if NoColor is set.
+func (file ConfigFile) baseTheme() (Theme, error) {
+	name := file.Theme
+	if name == "" {
+		name = DefaultTheme
+	}
+
+	if _, err := LoadTheme(name); err != nil {
+		return Theme{}, err
+	}
+
+	if file.NoColor {
+		name = "mono"
+	}
+
+	return LoadTheme(name)
+}
+
+// Keymap returns the default key bindings overridden by the keys in the file.
+func (file ConfigFile) Keymap() (Keymap, error) {
+	keymap := DefaultKeymap()
+	if err := keymap.Bind(file.Keys); err != nil {
+		return nil, err
+	}
+	return keymap, nil
+}
+
+// SetConfigValue sets a top-level string value in the configuration file,
+// keeping the rest of the file including comments. The file is created if it
+// does not exist.
+func SetConfigValue(path, key, value string) error {
+	return setConfigLine(path, key, fmt.Sprintf("%q", value))
+}
+
+// SetConfigList is like SetConfigValue but sets a list of strings.
+func SetConfigList(path, key string, values []string) error {
+	quoted := []string{}
+	for _, value := range values {
+		quoted = append(quoted, fmt.Sprintf("%q", value))
+	}
+	return setConfigLine(path, key, "["+strings.Join(quoted, ", ")+"]")
+}
+
+// setConfigLine sets a top-level key in the configuration file to a value
+// given in TOML syntax. A value spanning multiple lines is replaced as a
+// whole. The file is replaced atomically so that a crash does not leave it
+// truncated.
+func setConfigLine(path, key, value string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	assignment := fmt.Sprintf("%s = %s", key, value)
+	keyPattern := regexp.MustCompile(`^\s*` + regexp.QuoteMeta(key) + `\s*=`)
+
+	lines := []string{}
+	if len(data) > 0 {
+		lines = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
+
+	// Top-level keys must precede the first table. Values are skipped as a
+	// whole so that brackets in multi-line arrays are not taken as tables.
+	end := len(lines)
+	found, span := -1, 0
+
+	for i := 0; i < len(lines); {
+		line := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(line, "[") {
+			end = i
+			break
+		}
+
+		n := 1
+		if eq := strings.Index(lines[i], "="); eq != -1 && !strings.HasPrefix(line, "#") {
+			n = tomlValueLines(lines[i][eq+1:], lines[i+1:])
+			if found == -1 && keyPattern.MatchString(lines[i]) {
+				found, span = i, n
+			}
+		}
+		i += n
+	}
+
+	if found != -1 {
+		lines = append(lines[:found], append([]string{assignment}, lines[found+span:]...)...)
+	} else {
+		at := end
+		for at > 0 && strings.TrimSpace(lines[at-1]) == "" {
+			at--
+		}
+		lines = append(lines[:at], append([]string{assignment}, lines[at:]...)...)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	return WriteFileAtomic(path, []byte(strings.Join(lines, "\n")+"\n"))
+}
+
+// tomlValueLines returns the number of lines taken by a TOML value starting
+// with first, the rest of the line after "=", and continuing in the following
+// lines. Arrays, inline tables and multi-line strings may span lines.
+func tomlValueLines(first string, rest []string) int {
+	text := first
+	if len(rest) > 0 {
+		text += "\n" + strings.Join(rest, "\n")
+	}
+
+	lines, depth := 1, 0
+
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case strings.HasPrefix(text[i:], `"""`), strings.HasPrefix(text[i:], "'''"):
+			quote := text[i : i+3]
+			j := i + 3
+			for j < len(text) && !strings.HasPrefix(text[j:], quote) {
+				if quote == `"""` && text[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j > len(text) {
+				j = len(text)
+			}
+			lines += strings.Count(text[i:j], "\n")
+			i = j + 2
+
+		case c == '"' || c == '\'':
+			for i++; i < len(text) && text[i] != c && text[i] != '\n'; i++ {
+				if c == '"' && text[i] == '\\' {
+					i++
+				}
+			}
+			if i < len(text) && text[i] == '\n' {
+				i--
+			}
+
+		case c == '#':
+			for i < len(text)-1 && text[i+1] != '\n' {
+				i++
+			}
+
+		case c == '[' || c == '{':
+			depth++
+
+		case c == ']' || c == '}':
+			depth--
+
+		case c == '\n':
+			if depth <= 0 {
+				return lines
+			}
+			lines++
+		}
+	}
+
+	return lines
+}
+
+// WriteFileAtomic writes data to a temporary file in the directory of path
+// and renames it over path, so that readers never see a partially written
+// file. The permissions of an existing file are kept, and a symbolic link is
+// followed to replace its target.
+func WriteFileAtomic(path string, data []byte) error {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,304 @@
+package qtop
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_SetConfigValue_KeepsOtherContent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qtop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "qtop", "config.toml")
+
+	if err := SetConfigValue(path, "grouping", "queue"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	content := "# my settings\ngrouping = \"queue\"\n\n[table]\ngrouping = 1\n"
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetConfigValue(path, "grouping", "owner"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := SetConfigValue(path, "group_pattern", "-x$"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "# my settings\ngrouping = \"owner\"\ngroup_pattern = \"-x$\"\n\n[table]\ngrouping = 1\n"
+	if actual := string(data); actual != expected {
+		t.Errorf("unexpected content:\n%s\nwant:\n%s", actual, expected)
+	}
+}
+
+func Test_SetConfigList_WritesArray(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qtop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.toml")
+
+	if err := SetConfigList(path, "columns", []string{"user", "job:30"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	file, err := LoadConfigFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(file.Columns) != 2 || file.Columns[1] != "job:30" {
+		t.Errorf("unexpected columns: %v", file.Columns)
+	}
+}
+
+func Test_SetConfigList_ReplacesMultiLineValue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qtop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.toml")
+
+	content := `# my settings
+columns = [
+  "user",   # who
+  "job:30", # [wide]
+  "state",
+]
+filter = """
+state=R
+"""
+group_pattern = '[0-9]+$'
+
+[teams]
+lab = [
+  "alice",
+]
+`
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetConfigList(path, "columns", []string{"user", "ncpu"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := SetConfigValue(path, "filter", "mine"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := SetConfigValue(path, "grouping", "owner"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# my settings
+columns = ["user", "ncpu"]
+filter = "mine"
+group_pattern = '[0-9]+$'
+grouping = "owner"
+
+[teams]
+lab = [
+  "alice",
+]
+`
+	if actual := string(data); actual != expected {
+		t.Errorf("unexpected content:\n%s\nwant:\n%s", actual, expected)
+	}
+
+	if _, err := LoadConfigFile(path); err != nil {
+		t.Errorf("written file does not load: %s", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("permissions are not kept: %v", mode)
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("temporary files are left: %d entries", len(entries))
+	}
+}
+
+func Test_LoadConfigFile_AcceptsMissingFile(t *testing.T) {
+	file, err := LoadConfigFile("/nonexistent/qtop/config.toml")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if file.Grouping != "" {
+		t.Errorf("unexpected grouping: %q", file.Grouping)
+	}
+}
+
+func Test_LoadConfigFile_ReadsSettings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qtop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.toml")
+	content := `
+interval = "10s"
+sort = "cpu"
+sort_descending = true
+filter = "team=lab state=R"
+
+[colors]
+header = "white:blue"
+
+[keys]
+filter = "F"
+
+[teams]
+lab = ["alice", "bob"]
+`
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := LoadConfigFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	file = file.WithDefaults()
+
+	if err := file.Validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if interval, _ := file.RefreshInterval(); interval != 10*time.Second {
+		t.Errorf("unexpected interval: %s", interval)
+	}
+
+	opts, _ := file.Options()
+	if opts.Order != (JobOrder{SortCPUUsage, true}) {
+		t.Errorf("unexpected order: %+v", opts.Order)
+	}
+	if len(opts.Filter.Members) != 2 {
+		t.Errorf("team members are not resolved: %+v", opts.Filter)
+	}
+	if opts.History != defaultHistory {
+		t.Errorf("unexpected history: %d", opts.History)
+	}
+
+	if file.Colors["dim"] != "gray" || file.Colors["header"] != "white:blue" {
+		t.Errorf("unexpected colours: %v", file.Colors)
+	}
+
+	if file.Keys["filter"] != "F" || file.Keys["search"] != "/" {
+		t.Errorf("unexpected keys: %v", file.Keys)
+	}
+}
+
+func Test_LoadConfigFile_RejectsUnknownSetting(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qtop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.toml")
+	if err := ioutil.WriteFile(path, []byte("intervall = \"1s\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadConfigFile(path); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func Test_LoadConfigFile_KeepsZeroHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qtop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.toml")
+	if err := ioutil.WriteFile(path, []byte("history = 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := LoadConfigFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	opts, err := file.WithDefaults().Options()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if opts.History != 0 {
+		t.Errorf("unexpected history: %d", opts.History)
+	}
+}
+
+func Test_WriteFileAtomic_KeepsModeAndLink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qtop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	target := filepath.Join(dir, "metrics.prom")
+	link := filepath.Join(dir, "link.prom")
+	if err := ioutil.WriteFile(target, []byte("old\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteFileAtomic(link, []byte("new\n")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("link is replaced: %v", err)
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("unexpected mode: %s", info.Mode())
+	}
+	if data, _ := ioutil.ReadFile(target); string(data) != "new\n" {
+		t.Errorf("unexpected content: %q", data)
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 2 {
+		t.Errorf("temporary file is left: %d files", len(files))
+	}
+}
@@ -0,0 +1,435 @@
+package qtop
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell"
+	"github.com/snsinfu/torque-qtop/torque"
+)
+
+// jobTimeAttrs lists the timestamp attributes of a job in chronological order.
+var jobTimeAttrs = []struct {
+	name  string
+	label string
+}{
+	{"ctime", "Created"},
+	{"qtime", "Queued"},
+	{"etime", "Eligible"},
+	{"start_time", "Started"},
+	{"mtime", "Modified"},
+	{"comp_time", "Completed"},
+}
+
+// jobPathAttrs lists the path attributes of a job.
+var jobPathAttrs = []struct {
+	name  string
+	label string
+}{
+	{"init_work_dir", "Work dir"},
+	{"Output_Path", "Output"},
+	{"Error_Path", "Error"},
+}
+
+const (
+	resourceRequestPrefix = "Resource_List."
+	resourceUsagePrefix   = "resources_used."
+)
+
+// A jobDetail is a job detail panel being filled with the attributes of the
+// jobs queried in the background.
+type jobDetail struct {
+	panel    *panel
+	count    int
+	received int
+
+	// stop is closed to abandon the remaining queries when the panel closes.
+	stop chan struct{}
+}
+
+// A jobAttrsResult is the result of a background query of job attributes.
+type jobAttrsResult struct {
+	detail *jobDetail
+	id     string
+	attrs  map[string]string
+	err    error
+}
+
+// openJobDetail opens a panel listing all the attributes of the jobs in a job
+// group. The attributes are queried from the cluster in the background, and
+// the panel shows each job as its attributes arrive.
+func (app *App) openJobDetail(cluster Cluster, job JobSummary) {
+	title := fmt.Sprintf(
+		"%s: %s %s (%s, %d jobs)",
+		cluster.Name,
+		abbrevUsername(job.Owner),
+		job.Name,
+		job.State,
+		job.Count,
+	)
+	p := newPanel(title, app.theme)
+
+	d := &jobDetail{
+		panel: p,
+		count: len(job.IDs),
+		stop:  make(chan struct{}),
+	}
+	d.addProgress()
+
+	app.stopJobDetail()
+	app.panel = p
+	app.detail = d
+
+	go func(top *Top, ids []string) {
+		for _, id := range ids {
+			select {
+			case <-d.stop:
+				return
+			default:
+			}
+
+			attrs, err := top.JobAttrs(id)
+
+			select {
+			case app.details <- jobAttrsResult{d, id, attrs, err}:
+			case <-d.stop:
+				return
+			}
+		}
+	}(cluster.Top, job.IDs)
+}
+
+// receiveJobAttrs adds the attributes of a job to the detail panel if it is
+// still open.
+func (app *App) receiveJobAttrs(r jobAttrsResult) {
+	d := r.detail
+	if d != app.detail {
+		return
+	}
+
+	p := d.panel
+	if d.received < d.count {
+		p.lines = p.lines[:len(p.lines)-1]
+	}
+	if d.received > 0 {
+		p.add()
+	}
+	addJobDetail(p, r.id, r.attrs, r.err)
+
+	d.received++
+	d.addProgress()
+}
+
+// stopJobDetail abandons the queries of the job detail panel if it is no
+// longer shown.
+func (app *App) stopJobDetail() {
+	if d := app.detail; d != nil && d.panel != app.panel {
+		close(d.stop)
+		app.detail = nil
+	}
+}
+
+// addProgress appends a line telling how many jobs are still being queried.
+func (d *jobDetail) addProgress() {
+	if d.received < d.count {
+		d.panel.addText(
+			fmt.Sprintf("loading %d/%d...", d.received, d.count),
+			d.panel.theme.style(roleDim),
+		)
+	}
+}
+
+// addJobDetail appends the attributes of a job to a panel.
+func addJobDetail(p *panel, id string, attrs map[string]string, err error) {
+	styleID := p.theme.style(roleJID).Bold(true)
+
+	if err != nil {
+		p.add(
+			span{id + " ", styleID},
+			span{err.Error(), p.theme.style(roleNotice)},
+		)
+		return
+	}
+
+	shown := map[string]bool{}
+	field := func(label, name string) {
+		if value, ok := attrs[name]; ok {
+			p.addField(label, value)
+		}
+		shown[name] = true
+	}
+
+	p.add(
+		span{id + " ", styleID},
+		span{attrs["Job_Name"], tcell.StyleDefault.Bold(true)},
+	)
+	shown["Job_Name"] = true
+
+	field("Owner", "Job_Owner")
+	field("State", "job_state")
+	field("Queue", "queue")
+	field("Exec hosts", "exec_host")
+	field("Exit status", "exit_status")
+	field("Comment", "comment")
+
+	// Resources: used / requested
+
+	resources := map[string]bool{}
+	for name := range attrs {
+		if strings.HasPrefix(name, resourceRequestPrefix) {
+			resources[strings.TrimPrefix(name, resourceRequestPrefix)] = true
+		}
+		if strings.HasPrefix(name, resourceUsagePrefix) {
+			resources[strings.TrimPrefix(name, resourceUsagePrefix)] = true
+		}
+	}
+
+	if len(resources) > 0 {
+		p.addText("  Resources      used / requested", p.theme.style(roleDim))
+	}
+
+	for _, res := range sortedSet(resources) {
+		used, ok := attrs[resourceUsagePrefix+res]
+		if !ok {
+			used = "-"
+		}
+
+		requested, ok := attrs[resourceRequestPrefix+res]
+		if !ok {
+			requested = "-"
+		}
+
+		p.addField("  "+res, used+" / "+requested)
+		shown[resourceUsagePrefix+res] = true
+		shown[resourceRequestPrefix+res] = true
+	}
+
+	for _, path := range jobPathAttrs {
+		field(path.label, path.name)
+	}
+
+	for _, ts := range jobTimeAttrs {
+		if value, ok := attrs[ts.name]; ok {
+			p.addField(ts.label, formatTimestamp(value))
+		}
+		shown[ts.name] = true
+	}
+
+	// Everything else
+
+	others := map[string]bool{}
+	for name := range attrs {
+		if !shown[name] {
+			others[name] = true
+		}
+	}
+
+	if len(others) > 0 {
+		p.addText("  Other attributes", p.theme.style(roleDim))
+	}
+
+	for _, name := range sortedSet(others) {
+		p.addField("  "+name, attrs[name])
+	}
+}
+
+// formatTimestamp formats a timestamp attribute given in UNIX time. It returns
+// s as is if s is not a number.
+func formatTimestamp(s string) string {
+	sec, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return s
+	}
+	return time.Unix(sec, 0).Format("2006-01-02 15:04:05")
+}
+
+func sortedSet(set map[string]bool) []string {
+	keys := []string{}
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// A nodeJob is a running job with the slots it occupies on a node.
+type nodeJob struct {
+	job   torque.Job
+	slots []int
+}
+
+// nodeJobs lists the running jobs occupying slots on the named node, ordered
+// by the first slot index.
+func nodeJobs(node string, jobs []torque.Job) []nodeJob {
+	nodeJobs := []nodeJob{}
+
+	for _, job := range jobs {
+		if job.State != "R" {
+			continue
+		}
+
+		slots := []int{}
+		for _, slot := range job.ExecSlots {
+			if slot.Node == node {
+				slots = append(slots, slot.Index)
+			}
+		}
+
+		if len(slots) > 0 {
+			sort.Ints(slots)
+			nodeJobs = append(nodeJobs, nodeJob{job, slots})
+		}
+	}
+
+	sort.SliceStable(nodeJobs, func(i, j int) bool {
+		return nodeJobs[i].slots[0] < nodeJobs[j].slots[0]
+	})
+
+	return nodeJobs
+}
+
+// Marks identifying jobs in a slot map. Jobs beyond the marks share the last
+// mark.
+const slotMarks = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#"
+
+// Number of slots shown in a row of a slot map.
+const slotMapWidth = 16
+
+// openNodeDetail opens a panel showing the state of a node and the jobs
+// running on it.
+func (app *App) openNodeDetail(cluster Cluster, sum NodeSummary) {
+	p := newPanel(fmt.Sprintf("%s: %s", cluster.Name, sum.Name), app.theme)
+
+	snap := cluster.Top.Snapshot()
+	if snap == nil {
+		p.addText("No data", app.theme.style(roleNotice))
+		app.panel = p
+		return
+	}
+
+	var node torque.Node
+	for _, n := range snap.Nodes {
+		if n.Name == sum.Name {
+			node = n
+		}
+	}
+	jobs := nodeJobs(sum.Name, snap.Jobs)
+
+	addNodeDetail(p, node, sum, jobs)
+
+	app.panel = p
+}
+
+// addNodeDetail appends the state of a node, its jobs and its slot map to a
+// panel.
+func addNodeDetail(p *panel, node torque.Node, sum NodeSummary, jobs []nodeJob) {
+	styleHeading := p.theme.style(roleDim)
+	styleFree := p.theme.style(roleDim)
+
+	p.addField("State", node.State)
+	p.addField("Slots", fmt.Sprintf("%d used / %d", sum.UsedSlots, node.SlotCount))
+	if len(node.Properties) > 0 {
+		p.addField("Properties", strings.Join(node.Properties, " "))
+	}
+	if node.Note != "" {
+		p.addField("Note", node.Note)
+	}
+
+	// Jobs
+
+	p.add()
+	p.addText("  Jobs", styleHeading)
+	if len(jobs) == 0 {
+		p.addText("    (none)", styleFree)
+	}
+
+	owner := map[int]int{}
+
+	for i, nj := range jobs {
+		mark := slotMark(i)
+		style := p.theme.slotStyle(i)
+
+		for _, slot := range nj.slots {
+			owner[slot] = i
+		}
+
+		p.add(
+			span{"    " + mark + " ", style.Bold(true)},
+			span{padRight(abbrevUsername(nj.job.Owner), 10) + " ", tcell.StyleDefault},
+			span{fmt.Sprintf("%-12s ", abbrevID(nj.job.ID)), style},
+			span{nj.job.Name + " ", tcell.StyleDefault},
+			span{"slots " + formatSlots(nj.slots), styleFree},
+		)
+	}
+
+	// Slot map: one cell per slot labelled with the mark of the job occupying
+	// the slot.
+
+	p.add()
+	p.addText("  Slot map", styleHeading)
+
+	for first := 0; first < node.SlotCount; first += slotMapWidth {
+		line := []span{{fmt.Sprintf("    %4d ", first), styleFree}}
+
+		for slot := first; slot < first+slotMapWidth && slot < node.SlotCount; slot++ {
+			i, ok := owner[slot]
+			if !ok {
+				line = append(line, span{".", styleFree})
+				continue
+			}
+			style := p.theme.slotStyle(i).Bold(true)
+			line = append(line, span{slotMark(i), style})
+		}
+
+		p.add(line...)
+	}
+
+	// Status
+
+	if len(node.Status) > 0 {
+		p.add()
+		p.addText("  Status", styleHeading)
+
+		keys := []string{}
+		for key := range node.Status {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			p.addField("  "+key, node.Status[key])
+		}
+	}
+}
+
+// slotMark returns the mark identifying the i-th job in a slot map.
+func slotMark(i int) string {
+	if i >= len(slotMarks) {
+		i = len(slotMarks) - 1
+	}
+	return slotMarks[i : i+1]
+}
+
+// formatSlots formats sorted slot indices as comma-separated ranges.
+func formatSlots(slots []int) string {
+	ranges := []string{}
+
+	for i := 0; i < len(slots); {
+		j := i
+		for j+1 < len(slots) && slots[j+1] == slots[j]+1 {
+			j++
+		}
+
+		if i == j {
+			ranges = append(ranges, strconv.Itoa(slots[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", slots[i], slots[j]))
+		}
+		i = j + 1
+	}
+
+	return strings.Join(ranges, ",")
+}
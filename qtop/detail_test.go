@@ -0,0 +1,116 @@
+package qtop
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/snsinfu/torque-qtop/torque"
+)
+
+func Test_nodeJobs_ListsRunningJobsBySlot(t *testing.T) {
+	jobs := []torque.Job{
+		{
+			ID:    "1",
+			State: "R",
+			ExecSlots: []torque.Slot{
+				{Node: "node1", Index: 3},
+				{Node: "node2", Index: 0},
+				{Node: "node1", Index: 2},
+			},
+		},
+		{
+			ID:        "2",
+			State:     "R",
+			ExecSlots: []torque.Slot{{Node: "node1", Index: 0}},
+		},
+		{
+			ID:        "3",
+			State:     "C",
+			ExecSlots: []torque.Slot{{Node: "node1", Index: 1}},
+		},
+		{
+			ID:        "4",
+			State:     "R",
+			ExecSlots: []torque.Slot{{Node: "node2", Index: 1}},
+		},
+	}
+
+	actual := nodeJobs("node1", jobs)
+
+	if len(actual) != 2 {
+		t.Fatalf("unexpected number of jobs: got %d, want 2", len(actual))
+	}
+
+	if actual[0].job.ID != "2" || !reflect.DeepEqual(actual[0].slots, []int{0}) {
+		t.Errorf("unexpected first job: %v", actual[0])
+	}
+
+	if actual[1].job.ID != "1" || !reflect.DeepEqual(actual[1].slots, []int{2, 3}) {
+		t.Errorf("unexpected second job: %v", actual[1])
+	}
+}
+
+func Test_formatSlots_CompressesRanges(t *testing.T) {
+	actual := formatSlots([]int{0, 1, 2, 4, 6, 7})
+	expected := "0-2,4,6-7"
+
+	if actual != expected {
+		t.Errorf("unexpected result: got %q, want %q", actual, expected)
+	}
+}
+
+// detailSource is a Source whose job attribute queries block until the
+// attributes are sent.
+type detailSource struct {
+	staticSource
+	attrs chan map[string]string
+}
+
+func (src detailSource) QueryJobAttrs(id string) (map[string]string, error) {
+	return <-src.attrs, nil
+}
+
+func Test_App_QueriesJobDetailInBackground(t *testing.T) {
+	scr := newTestScreen(t, 80, 24)
+	defer scr.Fini()
+
+	src := detailSource{attrs: make(chan map[string]string, 2)}
+	cluster := Cluster{Name: "alpha", Top: NewSourceTop(src)}
+	app := NewApp([]Cluster{cluster}, scr, Config{})
+
+	job := JobSummary{Name: "sweep", Owner: "alice@login", State: "R", Count: 2, IDs: []string{"1[1].server", "1[2].server"}}
+	app.openJobDetail(cluster, job)
+
+	if app.panel == nil || len(app.panel.lines) != 1 {
+		t.Fatalf("panel is not opened while querying")
+	}
+
+	src.attrs <- map[string]string{"Job_Name": "sweep", "queue": "batch"}
+	app.receiveJobAttrs(<-app.details)
+
+	if n := len(app.panel.lines); n != 3 {
+		t.Errorf("unexpected number of lines: %d", n)
+	}
+	if text := app.panel.lines[len(app.panel.lines)-1][0].text; text != "loading 1/2..." {
+		t.Errorf("unexpected progress: %q", text)
+	}
+
+	// Closing the panel abandons the remaining query.
+	p := app.panel
+	lines := len(p.lines)
+
+	app.panel = nil
+	app.stopJobDetail()
+
+	src.attrs <- map[string]string{"Job_Name": "sweep"}
+	select {
+	case r := <-app.details:
+		app.receiveJobAttrs(r)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if len(p.lines) != lines || app.panel != nil {
+		t.Errorf("closed panel is updated")
+	}
+}
@@ -0,0 +1,259 @@
+package qtop
+
+import (
+	"errors"
+	"fmt"
+	"os/user"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/snsinfu/torque-qtop/torque"
+)
+
+// A Filter selects the jobs to summarize. Empty fields match any job, so the
+// zero Filter matches every job.
+type Filter struct {
+	// Owner is a username with or without the host part.
+	Owner string
+
+	// States is a set of job states such as "R" and "Q".
+	States []string
+
+	// Queue is the name of a queue.
+	Queue string
+
+	// Name is matched against the job name and the job ID.
+	Name *regexp.Regexp
+
+	// Mine selects the jobs of the current user.
+	Mine bool
+
+	// Team is the name of a team. The jobs of the Members are selected.
+	Team    string
+	Members []string
+}
+
+// ParseFilter parses a filter expression: space-separated terms of the form
+// key=value where key is owner, state, queue, name or team, or the term
+// "mine". state takes a comma-separated list of states. Any other term is
+// taken as a name pattern. Values containing spaces are written in double
+// quotes with Go escapes, e.g. name="a b". The members of a team are resolved
+// by WithTeams.
+func ParseFilter(s string) (Filter, error) {
+	var f Filter
+
+	terms, err := splitFilterTerms(s)
+	if err != nil {
+		return f, err
+	}
+
+	for _, term := range terms {
+		if term == "mine" {
+			f.Mine = true
+			continue
+		}
+
+		key, value := "name", term
+		if n := strings.Index(term, "="); n != -1 {
+			key, value = term[:n], term[n+1:]
+		}
+
+		switch key {
+		case "owner":
+			f.Owner = value
+
+		case "state":
+			f.States = strings.Split(value, ",")
+
+		case "queue":
+			f.Queue = value
+
+		case "team":
+			f.Team = value
+
+		case "name":
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return f, fmt.Errorf("bad name pattern: %s", err)
+			}
+			f.Name = re
+
+		default:
+			return f, fmt.Errorf("unknown filter key %q", key)
+		}
+	}
+
+	return f, nil
+}
+
+// splitFilterTerms splits a filter expression into space-separated terms,
+// unquoting double-quoted parts.
+func splitFilterTerms(s string) ([]string, error) {
+	terms := []string{}
+
+	var term strings.Builder
+	inTerm := false
+
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == '"':
+			end := i + 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return nil, errors.New("unterminated quote in filter")
+			}
+
+			value, err := strconv.Unquote(s[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("bad quoted value %s", s[i:end+1])
+			}
+			term.WriteString(value)
+			inTerm = true
+			i = end + 1
+
+		case strings.IndexByte(" \t\r\n", c) != -1:
+			if inTerm {
+				terms = append(terms, term.String())
+				term.Reset()
+				inTerm = false
+			}
+			i++
+
+		default:
+			term.WriteByte(c)
+			inTerm = true
+			i++
+		}
+	}
+
+	if inTerm {
+		terms = append(terms, term.String())
+	}
+	return terms, nil
+}
+
+// quoteFilterValue quotes a value of a filter term if it would not be parsed
+// back as is.
+func quoteFilterValue(value string) string {
+	if strings.ContainsAny(value, " \t\r\n\"") {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+// IsEmpty returns true if f matches every job.
+func (f Filter) IsEmpty() bool {
+	return f.Owner == "" && len(f.States) == 0 && f.Queue == "" && f.Name == nil && !f.Mine && f.Team == ""
+}
+
+// WithTeams returns f with the members of the team set from teams, which maps
+// team names to usernames. It is an error if the team is not in teams.
+func (f Filter) WithTeams(teams map[string][]string) (Filter, error) {
+	if f.Team == "" {
+		return f, nil
+	}
+
+	members, ok := teams[f.Team]
+	if !ok {
+		return f, fmt.Errorf("unknown team %q", f.Team)
+	}
+	f.Members = members
+
+	return f, nil
+}
+
+// String returns f as a filter expression accepted by ParseFilter.
+func (f Filter) String() string {
+	terms := []string{}
+
+	if f.Mine {
+		terms = append(terms, "mine")
+	}
+	if f.Owner != "" {
+		terms = append(terms, "owner="+quoteFilterValue(f.Owner))
+	}
+	if len(f.States) > 0 {
+		terms = append(terms, "state="+quoteFilterValue(strings.Join(f.States, ",")))
+	}
+	if f.Queue != "" {
+		terms = append(terms, "queue="+quoteFilterValue(f.Queue))
+	}
+	if f.Team != "" {
+		terms = append(terms, "team="+quoteFilterValue(f.Team))
+	}
+	if f.Name != nil {
+		terms = append(terms, "name="+quoteFilterValue(f.Name.String()))
+	}
+
+	return strings.Join(terms, " ")
+}
+
+// Match tests if a job passes the filter.
+func (f Filter) Match(job torque.Job) bool {
+	owner := abbrevUsername(job.Owner)
+
+	if f.Owner != "" && f.Owner != job.Owner && f.Owner != owner {
+		return false
+	}
+
+	if f.Mine && owner != currentUsername() {
+		return false
+	}
+
+	if f.Team != "" && !containsString(f.Members, owner) {
+		return false
+	}
+
+	if len(f.States) > 0 && !containsString(f.States, job.State) {
+		return false
+	}
+
+	if f.Queue != "" && f.Queue != job.Queue {
+		return false
+	}
+
+	if f.Name != nil && !f.Name.MatchString(job.Name) && !f.Name.MatchString(job.ID) {
+		return false
+	}
+
+	return true
+}
+
+// Apply returns the jobs passing the filter.
+func (f Filter) Apply(jobs []torque.Job) []torque.Job {
+	if f.IsEmpty() {
+		return jobs
+	}
+
+	matched := []torque.Job{}
+	for _, job := range jobs {
+		if f.Match(job) {
+			matched = append(matched, job)
+		}
+	}
+	return matched
+}
+
+// currentUsername returns the name of the user running the program.
+func currentUsername() string {
+	me, err := user.Current()
+	if err != nil {
+		return ""
+	}
+	return me.Username
+}
+
+func containsString(arr []string, s string) bool {
+	for _, elem := range arr {
+		if elem == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+package qtop
+
+import (
+	"testing"
+
+	"github.com/snsinfu/torque-qtop/torque"
+)
+
+func Test_ParseFilter_RoundTrips(t *testing.T) {
+	expr := "owner=alice state=R,Q queue=batch name=^sim"
+
+	filter, err := ParseFilter(expr)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if actual := filter.String(); actual != expr {
+		t.Errorf("unexpected expression: got %q, want %q", actual, expr)
+	}
+}
+
+func Test_ParseFilter_QuotesValues(t *testing.T) {
+	testCases := []struct {
+		expr   string
+		name   string
+		result string
+	}{
+		{`name="a b"`, "a b", `name="a b"`},
+		{`"relax run"`, "relax run", `name="relax run"`},
+		{`name="say \"hi\"" owner=alice`, `say "hi"`, `owner=alice name="say \"hi\""`},
+		{`name=^sim\d+`, `^sim\d+`, `name=^sim\d+`},
+	}
+
+	for _, tc := range testCases {
+		filter, err := ParseFilter(tc.expr)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tc.expr, err)
+			continue
+		}
+
+		if filter.Name == nil || filter.Name.String() != tc.name {
+			t.Errorf("%s: unexpected name pattern: %v", tc.expr, filter.Name)
+		}
+		if actual := filter.String(); actual != tc.result {
+			t.Errorf("%s: unexpected expression: got %q, want %q", tc.expr, actual, tc.result)
+		}
+	}
+
+	if _, err := ParseFilter(`name="a b`); err == nil {
+		t.Error("expected error for unterminated quote")
+	}
+}
+
+func Test_ParseFilter_RejectsUnknownKey(t *testing.T) {
+	if _, err := ParseFilter("user=alice"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func Test_Filter_Match(t *testing.T) {
+	job := torque.Job{
+		ID:    "101.server",
+		Name:  "sim-1",
+		Owner: "alice@login",
+		State: "R",
+		Queue: "batch",
+	}
+
+	testCases := []struct {
+		expr  string
+		match bool
+	}{
+		{"", true},
+		{"owner=alice", true},
+		{"owner=alice@login", true},
+		{"owner=bob", false},
+		{"state=Q,R", true},
+		{"state=Q", false},
+		{"queue=batch", true},
+		{"queue=long", false},
+		{"name=^sim", true},
+		{"name=^101", true},
+		{"relax", false},
+	}
+
+	for _, tc := range testCases {
+		filter, err := ParseFilter(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if actual := filter.Match(job); actual != tc.match {
+			t.Errorf("%q: got %v, want %v", tc.expr, actual, tc.match)
+		}
+	}
+}
+
+func Test_Filter_WithTeams(t *testing.T) {
+	teams := map[string][]string{
+		"lab": {"alice", "carol"},
+	}
+
+	filter, err := ParseFilter("team=lab")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	filter, err = filter.WithTeams(teams)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !filter.Match(torque.Job{Owner: "alice@login"}) {
+		t.Error("member's job is not matched")
+	}
+
+	if filter.Match(torque.Job{Owner: "bob@login"}) {
+		t.Error("non-member's job is matched")
+	}
+
+	unknown := Filter{Team: "other"}
+	if _, err := unknown.WithTeams(teams); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func Test_Summarize_MarksFilteredTotals(t *testing.T) {
+	snap := testClusters()[0].Top.Snapshot()
+
+	filter, _ := ParseFilter("state=Q")
+	sum := Summarize(snap.Nodes, snap.Jobs, Options{Filter: filter})
+
+	if sum.Global == nil {
+		t.Fatal("global totals are missing")
+	}
+
+	if sum.Cluster.RunningJobs != 0 || sum.Cluster.WaitingJobs != 1 {
+		t.Errorf("unexpected filtered totals: %+v", sum.Cluster)
+	}
+
+	if sum.Global.RunningJobs != 1 || sum.Global.WaitingJobs != 1 {
+		t.Errorf("unexpected global totals: %+v", *sum.Global)
+	}
+
+	if sum.Cluster.FreeSlots != sum.Global.FreeSlots {
+		t.Errorf("free slots differ: got %d, want %d", sum.Cluster.FreeSlots, sum.Global.FreeSlots)
+	}
+
+	if len(sum.Jobs) != 1 {
+		t.Errorf("unexpected number of job groups: %d", len(sum.Jobs))
+	}
+}
@@ -0,0 +1,124 @@
+package qtop
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/snsinfu/torque-qtop/torque"
+)
+
+// A GroupMode is a way of grouping jobs into rows of the job list.
+type GroupMode int
+
+// Group modes in the order cycled through in the App.
+const (
+	// GroupByName groups jobs by owner, state and the job name with a suffix
+	// like "-123" removed.
+	GroupByName GroupMode = iota
+
+	// GroupByArray groups the jobs of an array job.
+	GroupByArray
+
+	// GroupByQueue groups jobs by queue and state.
+	GroupByQueue
+
+	// GroupByOwner groups jobs by owner and state.
+	GroupByOwner
+
+	// GroupNone shows each job in its own row.
+	GroupNone
+
+	groupModeCount
+)
+
+var groupModeNames = []string{
+	"name",
+	"array",
+	"queue",
+	"owner",
+	"none",
+}
+
+// ParseGroupMode returns the group mode with given name.
+func ParseGroupMode(name string) (GroupMode, error) {
+	for i, modeName := range groupModeNames {
+		if modeName == name {
+			return GroupMode(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown grouping %q", name)
+}
+
+func (mode GroupMode) String() string {
+	if mode < 0 || mode >= groupModeCount {
+		return fmt.Sprint(int(mode))
+	}
+	return groupModeNames[mode]
+}
+
+// Next returns the next group mode, wrapping around at the end.
+func (mode GroupMode) Next() GroupMode {
+	return (mode + 1) % groupModeCount
+}
+
+// A Grouping specifies how jobs are grouped. The zero Grouping groups jobs by
+// name with the default suffix pattern.
+type Grouping struct {
+	Mode GroupMode
+
+	// Pattern matches the part of a job name removed in GroupByName mode. If
+	// nil, a suffix of a hyphen and digits like "-123" is removed.
+	Pattern *regexp.Regexp
+}
+
+// groupKey identifies the group of a job.
+type groupKey struct {
+	Key   string
+	Owner string
+	State string
+}
+
+// group returns the key identifying the group of a job and the name shown for
+// the group.
+func (g Grouping) group(job torque.Job) (groupKey, string) {
+	switch g.Mode {
+	case GroupByArray:
+		name := basename(job.Name)
+		return groupKey{arrayParent(job.ID), job.Owner, job.State}, name
+
+	case GroupByQueue:
+		return groupKey{job.Queue, "", job.State}, job.Queue
+
+	case GroupByOwner:
+		return groupKey{"", job.Owner, job.State}, ""
+
+	case GroupNone:
+		return groupKey{job.ID, job.Owner, job.State}, job.Name
+	}
+
+	pattern := g.Pattern
+	if pattern == nil {
+		pattern = jobSuffixPattern
+	}
+	name := pattern.ReplaceAllString(job.Name, "")
+
+	return groupKey{name, job.Owner, job.State}, name
+}
+
+// arrayParent returns the ID of the array job containing the job with given
+// ID, like "123[].server" for "123[4].server". It returns id as is if the job
+// is not a part of an array job.
+func arrayParent(id string) string {
+	open := strings.Index(id, "[")
+	if open == -1 {
+		return id
+	}
+
+	end := strings.Index(id[open:], "]")
+	if end == -1 {
+		return id
+	}
+
+	return id[:open+1] + id[open+end:]
+}
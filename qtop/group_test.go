@@ -0,0 +1,54 @@
+package qtop
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/snsinfu/torque-qtop/torque"
+)
+
+func Test_SummarizeJobs_GroupsByMode(t *testing.T) {
+	jobs := []torque.Job{
+		{ID: "10[1].server", Name: "sim-1", Owner: "alice", State: "Q", Queue: "batch"},
+		{ID: "10[2].server", Name: "sim-2", Owner: "alice", State: "Q", Queue: "batch"},
+		{ID: "11.server", Name: "sim-3", Owner: "alice", State: "Q", Queue: "long"},
+		{ID: "12.server", Name: "relax", Owner: "bob", State: "Q", Queue: "long"},
+	}
+
+	testCases := []struct {
+		grouping Grouping
+		count    int
+	}{
+		{Grouping{Mode: GroupByName}, 2},
+		{Grouping{Mode: GroupByArray}, 3},
+		{Grouping{Mode: GroupByQueue}, 2},
+		{Grouping{Mode: GroupByOwner}, 2},
+		{Grouping{Mode: GroupNone}, 4},
+		{Grouping{Mode: GroupByName, Pattern: regexp.MustCompile(`-[12]$`)}, 3},
+	}
+
+	for _, tc := range testCases {
+		sums := SummarizeJobs(jobs, tc.grouping, JobOrder{})
+
+		if len(sums) != tc.count {
+			t.Errorf("%v: got %d groups, want %d", tc.grouping.Mode, len(sums), tc.count)
+		}
+	}
+}
+
+func Test_arrayParent(t *testing.T) {
+	testCases := []struct {
+		id     string
+		parent string
+	}{
+		{"123[4].server", "123[].server"},
+		{"123[].server", "123[].server"},
+		{"123.server", "123.server"},
+	}
+
+	for _, tc := range testCases {
+		if actual := arrayParent(tc.id); actual != tc.parent {
+			t.Errorf("%q: got %q, want %q", tc.id, actual, tc.parent)
+		}
+	}
+}
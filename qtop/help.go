@@ -0,0 +1,84 @@
+package qtop
+
+import (
+	"strings"
+
+	"github.com/gdamore/tcell"
+)
+
+// overlayBindings lists the keys of the overlays, which cannot be changed.
+var overlayBindings = []struct {
+	context string
+	keys    string
+	desc    string
+}{
+	{"Prompt", "Enter", "Apply"},
+	{"Prompt", "Esc", "Cancel"},
+	{"Prompt", "Ctrl-U", "Clear the text"},
+	{"Detail view", "Up Down k j", "Scroll"},
+	{"Detail view", "PgUp PgDn", "Scroll by a page"},
+	{"Detail view", "Home End g G", "Scroll to the top or bottom"},
+	{"Detail view", "Esc q", "Close"},
+	{"Column picker", "Up Down k j", "Move the selection"},
+	{"Column picker", "Space x", "Show or hide the column"},
+	{"Column picker", "K J", "Move the column up or down"},
+	{"Column picker", "< > - +", "Narrow or widen the column"},
+	{"Column picker", "=", "Reset the width"},
+	{"Column picker", "Enter", "Apply"},
+	{"Column picker", "Esc q", "Cancel"},
+}
+
+// hintActions lists the actions shown in the hint bar with short labels.
+var hintActions = []struct {
+	action string
+	label  string
+}{
+	{actionHelp, "help"},
+	{actionQuit, "quit"},
+	{actionOpen, "details"},
+	{actionSearch, "search"},
+	{actionFilter, "filter"},
+	{actionSortNext, "sort"},
+	{actionGroup, "group"},
+	{actionColumns, "columns"},
+	{actionPause, "pause"},
+}
+
+// helpKeyWidth is the width of the key column in the help.
+const helpKeyWidth = 16
+
+// openHelp opens a panel listing the key bindings grouped by context. The
+// playback keys are listed only while replaying a recording.
+func (app *App) openHelp() {
+	p := newPanel("Keys", app.theme)
+
+	context := ""
+	addKeys := func(ctx string, keys []string, desc string) {
+		if ctx != context {
+			if context != "" {
+				p.add()
+			}
+			p.addText(ctx, app.theme.style(roleHeading))
+			context = ctx
+		}
+		p.add(
+			span{"  " + padRight(strings.Join(keys, " "), helpKeyWidth) + " ", tcell.StyleDefault},
+			span{desc, app.theme.style(roleDim)},
+		)
+	}
+
+	for _, binding := range defaultBindings {
+		if binding.context == contextPlayback && app.config.Player == nil {
+			continue
+		}
+		if keys := app.keymap.keysOf(binding.action); len(keys) > 0 {
+			addKeys(binding.context, keys, binding.desc)
+		}
+	}
+
+	for _, binding := range overlayBindings {
+		addKeys(binding.context, strings.Fields(binding.keys), binding.desc)
+	}
+
+	app.panel = p
+}
@@ -0,0 +1,60 @@
+package qtop
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// panelText returns the lines of p as text.
+func panelText(p *panel) []string {
+	lines := []string{}
+	for _, spans := range p.lines {
+		line := ""
+		for _, sp := range spans {
+			line += sp.text
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func Test_App_openHelp_ListsRemappedKeys(t *testing.T) {
+	km := DefaultKeymap()
+	km.Bind(map[string]string{"filter": "F Ctrl-F"})
+
+	app := NewApp(nil, nil, Config{Keymap: km})
+	app.openHelp()
+
+	text := strings.Join(panelText(app.panel), "\n")
+
+	if !strings.Contains(text, "  Ctrl-F F         Edit the job filter") {
+		t.Errorf("remapped keys are not listed:\n%s", text)
+	}
+	if !strings.Contains(text, "Job list\n") || !strings.Contains(text, "Column picker\n") {
+		t.Errorf("contexts are not listed:\n%s", text)
+	}
+	if strings.Contains(text, "Play faster") {
+		t.Errorf("playback keys are listed without a recording")
+	}
+}
+
+func Test_App_drawHints_ShowsBoundKeys(t *testing.T) {
+	scr := newTestScreen(t, 60, 2)
+	defer scr.Fini()
+
+	km := DefaultKeymap()
+	km.Bind(map[string]string{"help": "h"})
+
+	app := NewApp(nil, scr, Config{Keymap: km, Interval: time.Second})
+	bottom := app.bottomModel(time.Now())
+	app.renderer.(*screenRenderer).drawHints(1, bottom.hints)
+
+	row := screenRow(scr, 1)
+	if !strings.HasPrefix(row, "  h help  q quit  Enter details  / search") {
+		t.Errorf("unexpected hints: %q", row)
+	}
+	if len(row) > 60-xMargin {
+		t.Errorf("hints overflow: %q", row)
+	}
+}
@@ -0,0 +1,219 @@
+package qtop
+
+import (
+	"math"
+	"time"
+)
+
+// defaultHistory is the number of summaries kept for the trends if not
+// specified.
+const defaultHistory = 60
+
+// sparkRunes are the bars of a sparkline from the lowest to the highest.
+var sparkRunes = []rune("▁▂▃▄▅▆▇█")
+
+// A Sample is a summary of a cluster kept in the history.
+type Sample struct {
+	Time    time.Time
+	Summary *Summary
+
+	// Grouping is the group mode of the jobs in the summary.
+	Grouping GroupMode
+}
+
+// A history is a ring buffer keeping the latest samples up to its size.
+type history struct {
+	size    int
+	samples []Sample
+	start   int
+}
+
+// add appends a sample, dropping the oldest one if the history is full.
+func (h *history) add(s Sample) {
+	if h.size <= 0 {
+		return
+	}
+	if len(h.samples) < h.size {
+		h.samples = append(h.samples, s)
+		return
+	}
+	h.samples[h.start] = s
+	h.start = (h.start + 1) % h.size
+}
+
+// list returns the samples from the oldest to the latest.
+func (h *history) list() []Sample {
+	list := make([]Sample, 0, len(h.samples))
+	list = append(list, h.samples[h.start:]...)
+	return append(list, h.samples[:h.start]...)
+}
+
+// last returns the latest sample. It returns false if the history is empty.
+func (h *history) last() (Sample, bool) {
+	if len(h.samples) == 0 {
+		return Sample{}, false
+	}
+	return h.samples[(h.start+len(h.samples)-1)%len(h.samples)], true
+}
+
+// setLast replaces the latest sample if it is taken at the same time as s.
+func (h *history) setLast(s Sample) {
+	if last, ok := h.last(); ok && last.Time.Equal(s.Time) {
+		h.samples[(h.start+len(h.samples)-1)%len(h.samples)] = s
+	}
+}
+
+// resize changes the size of the history, keeping the latest samples.
+func (h *history) resize(size int) {
+	list := h.list()
+	if size < 0 {
+		size = 0
+	}
+	if len(list) > size {
+		list = list[len(list)-size:]
+	}
+	h.size = size
+	h.samples = list
+	h.start = 0
+}
+
+// clear removes all the samples.
+func (h *history) clear() {
+	h.samples = nil
+	h.start = 0
+}
+
+// trends are the series of values taken from the samples in a history, from
+// the oldest to the latest. A value is NaN if missing in a sample.
+type trends struct {
+	// usage is the fraction of the used slots of the cluster.
+	usage []float64
+
+	// waiting is the number of waiting jobs.
+	waiting []float64
+
+	// nodes maps node names to the fraction of the used slots.
+	nodes map[string][]float64
+
+	// jobs maps job groups to the CPU usage, which is one for a fully used
+	// slot. Only the samples grouped in the current group mode have values.
+	jobs map[groupKey][]float64
+
+	grouping GroupMode
+}
+
+// makeTrends takes the trends from samples with the jobs grouped in mode.
+func makeTrends(samples []Sample, mode GroupMode) *trends {
+	t := &trends{
+		usage:    make([]float64, len(samples)),
+		waiting:  make([]float64, len(samples)),
+		nodes:    map[string][]float64{},
+		jobs:     map[groupKey][]float64{},
+		grouping: mode,
+	}
+
+	for i, s := range samples {
+		cluster := s.Summary.Cluster
+
+		t.usage[i] = math.NaN()
+		if total := s.Summary.Capacity(); total > 0 {
+			t.usage[i] = float64(cluster.UsedSlots) / float64(total)
+		}
+		t.waiting[i] = float64(cluster.WaitingJobs)
+
+		for _, node := range s.Summary.Nodes {
+			if !node.Active || node.AvailSlots == 0 {
+				continue
+			}
+			if t.nodes[node.Name] == nil {
+				t.nodes[node.Name] = nanSeries(len(samples))
+			}
+			t.nodes[node.Name][i] = float64(node.UsedSlots) / float64(node.AvailSlots)
+		}
+
+		if s.Grouping != mode {
+			continue
+		}
+		for _, job := range s.Summary.Jobs {
+			key := trendKey(job, mode)
+			if t.jobs[key] == nil {
+				t.jobs[key] = nanSeries(len(samples))
+			}
+			t.jobs[key][i] = job.CPUUsage
+		}
+	}
+
+	return t
+}
+
+// job returns the CPU usage trend of a job group, or nil if unknown.
+func (t *trends) job(job JobSummary) []float64 {
+	return t.jobs[trendKey(job, t.grouping)]
+}
+
+// trendKey identifies a job group across the summaries grouped in mode. The
+// names of the groups are not unique in some modes, where the first job ID
+// identifies the group instead.
+func trendKey(job JobSummary, mode GroupMode) groupKey {
+	if len(job.IDs) > 0 {
+		switch mode {
+		case GroupNone:
+			return groupKey{job.IDs[0], job.Owner, job.State}
+
+		case GroupByArray:
+			return groupKey{arrayParent(job.IDs[0]), job.Owner, job.State}
+		}
+	}
+	return groupKey{job.Name, job.Owner, job.State}
+}
+
+// nanSeries returns a series of n missing values.
+func nanSeries(n int) []float64 {
+	s := make([]float64, n)
+	for i := range s {
+		s[i] = math.NaN()
+	}
+	return s
+}
+
+// sparkline draws the last width values as bars scaled from zero to max. NaN
+// values are drawn as spaces. The line is shorter than width if there are
+// fewer values.
+func sparkline(values []float64, max float64, width int) string {
+	if len(values) > width {
+		values = values[len(values)-width:]
+	}
+
+	line := make([]rune, len(values))
+	for i, v := range values {
+		if math.IsNaN(v) {
+			line[i] = ' '
+			continue
+		}
+
+		level := 0
+		if max > 0 {
+			level = int(math.Round(v / max * float64(len(sparkRunes)-1)))
+		}
+		if level < 0 {
+			level = 0
+		}
+		if level >= len(sparkRunes) {
+			level = len(sparkRunes) - 1
+		}
+		line[i] = sparkRunes[level]
+	}
+	return string(line)
+}
+
+// seriesMax returns the largest value in values ignoring NaN, or zero if there
+// is none.
+func seriesMax(values []float64) float64 {
+	max := 0.0
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	return max
+}
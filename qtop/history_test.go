@@ -0,0 +1,206 @@
+package qtop
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/snsinfu/torque-qtop/torque"
+)
+
+func sampleTimes(samples []Sample) []int {
+	secs := []int{}
+	for _, s := range samples {
+		secs = append(secs, s.Time.Second())
+	}
+	return secs
+}
+
+func Test_history_KeepsLatestSamples(t *testing.T) {
+	h := history{size: 3}
+	for sec := 1; sec <= 5; sec++ {
+		h.add(Sample{Time: time.Date(2019, 6, 1, 12, 0, sec, 0, time.UTC)})
+	}
+
+	if actual := sampleTimes(h.list()); len(actual) != 3 || actual[0] != 3 || actual[2] != 5 {
+		t.Errorf("unexpected samples: %v", actual)
+	}
+	if last, _ := h.last(); last.Time.Second() != 5 {
+		t.Errorf("unexpected last sample: %v", last.Time)
+	}
+
+	h.resize(2)
+	if actual := sampleTimes(h.list()); len(actual) != 2 || actual[0] != 4 || actual[1] != 5 {
+		t.Errorf("unexpected samples after shrinking: %v", actual)
+	}
+
+	h.resize(4)
+	h.add(Sample{Time: time.Date(2019, 6, 1, 12, 0, 6, 0, time.UTC)})
+	if actual := sampleTimes(h.list()); len(actual) != 3 || actual[2] != 6 {
+		t.Errorf("unexpected samples after growing: %v", actual)
+	}
+}
+
+func Test_history_KeepsNothingWithoutSize(t *testing.T) {
+	h := history{}
+	h.add(Sample{Time: time.Now()})
+
+	if _, ok := h.last(); ok {
+		t.Errorf("sample is kept")
+	}
+}
+
+func Test_sparkline(t *testing.T) {
+	nan := math.NaN()
+
+	testCases := []struct {
+		values []float64
+		max    float64
+		width  int
+		result string
+	}{
+		{[]float64{0, 0.5, 1}, 1, 5, "▁▅█"},
+		{[]float64{0, 1, 2, 3, 4}, 4, 3, "▅▆█"},
+		{[]float64{1, nan, 2}, 2, 3, "▅ █"},
+		{[]float64{3, 5}, 2, 2, "██"},
+		{[]float64{1, 2}, 0, 2, "▁▁"},
+		{nil, 1, 3, ""},
+	}
+
+	for _, tc := range testCases {
+		if actual := sparkline(tc.values, tc.max, tc.width); actual != tc.result {
+			t.Errorf("sparkline(%v, %g, %d) = %q, want %q", tc.values, tc.max, tc.width, actual, tc.result)
+		}
+	}
+}
+
+func Test_Top_KeepsHistory(t *testing.T) {
+	start := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	src := &sequenceSource{}
+	for i, used := range []int{0, 2, 4, 2} {
+		slots := []torque.Slot{}
+		for k := 0; k < used; k++ {
+			slots = append(slots, torque.Slot{Node: "node1", Index: k})
+		}
+
+		src.snaps = append(src.snaps, &Snapshot{
+			Time:  start.Add(time.Duration(i) * time.Minute),
+			Nodes: []torque.Node{{Name: "node1", State: "free", SlotCount: 4}},
+			Jobs: []torque.Job{
+				{ID: "1.server", Name: "sim", Owner: "alice@login", State: "R", ExecSlots: slots, Walltime: 60, CPUTime: 60 * used},
+			},
+		})
+	}
+
+	top := NewSourceTop(src)
+	top.SetOptions(Options{History: 3})
+	for range src.snaps {
+		if err := top.Update(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := len(top.History()); n != 3 {
+		t.Fatalf("unexpected history length: %d", n)
+	}
+
+	trends := top.trends()
+	if actual := sparkline(trends.nodes["node1"], 1, 3); actual != "▅█▅" {
+		t.Errorf("unexpected node trend: %q", actual)
+	}
+	if actual := sparkline(trends.job(top.Current().Jobs[0]), 4, 3); actual != "▅█▅" {
+		t.Errorf("unexpected job trend: %q", actual)
+	}
+
+	// Regrouping keeps the trends of the nodes, but the job trend starts over.
+	top.SetOptions(Options{History: 3, Grouping: Grouping{Mode: GroupByOwner}})
+
+	trends = top.trends()
+	if actual := sparkline(trends.nodes["node1"], 1, 3); actual != "▅█▅" {
+		t.Errorf("unexpected node trend after regrouping: %q", actual)
+	}
+	if actual := sparkline(trends.job(top.Current().Jobs[0]), 4, 3); actual != "  ▅" {
+		t.Errorf("unexpected job trend after regrouping: %q", actual)
+	}
+}
+
+func Test_Top_RestartsHistoryGoingBack(t *testing.T) {
+	start := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	src := &sequenceSource{snaps: []*Snapshot{
+		{Time: start},
+		{Time: start.Add(time.Minute)},
+		{Time: start.Add(-time.Minute)},
+	}}
+
+	top := NewSourceTop(src)
+	top.SetOptions(Options{History: 10})
+	for range src.snaps {
+		top.Update()
+	}
+
+	if n := len(top.History()); n != 1 {
+		t.Errorf("unexpected history length: %d", n)
+	}
+}
+
+func Test_Top_ReplacesSampleOfSameSnapshot(t *testing.T) {
+	snap := &Snapshot{Time: time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)}
+
+	top := NewSourceTop(staticSource{snap})
+	top.SetOptions(Options{History: 10})
+	for i := 0; i < 4; i++ {
+		if err := top.Update(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := len(top.History()); n != 1 {
+		t.Errorf("unexpected history length: %d", n)
+	}
+}
+
+func Test_trendKey_IdentifiesGroups(t *testing.T) {
+	a := JobSummary{Name: "sim", Owner: "alice", State: "R", IDs: []string{"1.server"}}
+	b := JobSummary{Name: "sim", Owner: "alice", State: "R", IDs: []string{"2.server"}}
+
+	if trendKey(a, GroupByName) != trendKey(b, GroupByName) {
+		t.Errorf("groups of the same name are told apart")
+	}
+	if trendKey(a, GroupNone) == trendKey(b, GroupNone) {
+		t.Errorf("jobs of the same name are not told apart")
+	}
+
+	c := JobSummary{Name: "sweep", Owner: "alice", State: "R", IDs: []string{"3[1].server"}}
+	d := JobSummary{Name: "sweep", Owner: "alice", State: "R", IDs: []string{"3[2].server"}}
+	if trendKey(c, GroupByArray) != trendKey(d, GroupByArray) {
+		t.Errorf("array jobs are told apart")
+	}
+}
+
+func Test_makeTrends_UsageAgainstCapacity(t *testing.T) {
+	filter, err := ParseFilter("owner=alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nodes := []torque.Node{
+		{Name: "node1", State: "free", SlotCount: 4},
+		{Name: "node2", State: "down", SlotCount: 4},
+	}
+	jobs := []torque.Job{
+		{ID: "1.server", Owner: "alice@login", State: "R", ExecSlots: []torque.Slot{{Node: "node1", Index: 0}}},
+		{ID: "2.server", Owner: "bob@login", State: "R", ExecSlots: []torque.Slot{{Node: "node1", Index: 1}, {Node: "node1", Index: 2}}},
+	}
+
+	sum := Summarize(nodes, jobs, Options{Filter: filter})
+	if c := sum.Capacity(); c != 4 {
+		t.Errorf("unexpected capacity: %d", c)
+	}
+
+	trends := makeTrends([]Sample{{Summary: &sum}}, GroupNone)
+	if u := trends.usage[0]; u != 0.25 {
+		t.Errorf("unexpected usage: %g", u)
+	}
+}
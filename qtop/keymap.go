@@ -0,0 +1,263 @@
+package qtop
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell"
+)
+
+// Actions of the App bound to keys.
+const (
+	actionHelp        = "help"
+	actionQuit        = "quit"
+	actionRedraw      = "redraw"
+	actionNextTab     = "next-tab"
+	actionPrevTab     = "prev-tab"
+	actionUp          = "up"
+	actionDown        = "down"
+	actionPageUp      = "page-up"
+	actionPageDown    = "page-down"
+	actionTop         = "top"
+	actionBottom      = "bottom"
+	actionOpen        = "open"
+	actionClear       = "clear-search"
+	actionFocus       = "toggle-focus"
+	actionLegend      = "legend"
+	actionFilter      = "filter"
+	actionSearch      = "search"
+	actionNextMatch   = "next-match"
+	actionPrevMatch   = "prev-match"
+	actionSortNext    = "sort-next"
+	actionSortPrev    = "sort-prev"
+	actionSortReverse = "sort-reverse"
+	actionGroup       = "group"
+	actionColumns     = "columns"
+	actionErrors      = "errors"
+	actionRefresh     = "refresh"
+	actionIncInterval = "interval-up"
+	actionDecInterval = "interval-down"
+	actionPause       = "pause"
+	actionStepForward = "step-forward"
+	actionStepBack    = "step-back"
+	actionFaster      = "faster"
+	actionSlower      = "slower"
+)
+
+// Contexts of the actions, which group the actions in the help.
+const (
+	contextGeneral  = "General"
+	contextMove     = "Navigation"
+	contextSearch   = "Search"
+	contextJobs     = "Job list"
+	contextUpdates  = "Updates"
+	contextPlayback = "Playback"
+)
+
+// defaultBindings lists the default keys of the actions with descriptions
+// shown in the help.
+var defaultBindings = []struct {
+	action  string
+	keys    string
+	context string
+	desc    string
+}{
+	{actionHelp, "?", contextGeneral, "Show this help"},
+	{actionQuit, "q Q", contextGeneral, "Quit"},
+	{actionRedraw, "Ctrl-L", contextGeneral, "Redraw the screen"},
+	{actionNextTab, "Tab", contextGeneral, "Switch to the next cluster tab"},
+	{actionPrevTab, "Backtab", contextGeneral, "Switch to the previous cluster tab"},
+	{actionLegend, "l", contextGeneral, "Show or hide the legend of slot colours"},
+	{actionFocus, "w", contextMove, "Switch focus between node and job lists"},
+	{actionUp, "Up k", contextMove, "Move the selection up"},
+	{actionDown, "Down j", contextMove, "Move the selection down"},
+	{actionPageUp, "PgUp", contextMove, "Move the selection up by a page"},
+	{actionPageDown, "PgDn", contextMove, "Move the selection down by a page"},
+	{actionTop, "Home g", contextMove, "Move the selection to the top"},
+	{actionBottom, "End G", contextMove, "Move the selection to the bottom"},
+	{actionOpen, "Enter", contextMove, "Show details of the selected node or job"},
+	{actionSearch, "/", contextSearch, "Search jobs, owners, job IDs and nodes"},
+	{actionNextMatch, "n", contextSearch, "Jump to the next match"},
+	{actionPrevMatch, "N", contextSearch, "Jump to the previous match"},
+	{actionClear, "Esc", contextSearch, "Clear the search"},
+	{actionFilter, "f", contextJobs, "Edit the job filter"},
+	{actionSortNext, "s", contextJobs, "Sort jobs by the next column"},
+	{actionSortPrev, "S", contextJobs, "Sort jobs by the previous column"},
+	{actionSortReverse, "r", contextJobs, "Reverse the sort order"},
+	{actionGroup, "c", contextJobs, "Cycle job grouping"},
+	{actionColumns, "C", contextJobs, "Choose, order and size job columns"},
+	{actionPause, "Space", contextUpdates, "Pause or resume updates or playback"},
+	{actionRefresh, "R", contextUpdates, "Refresh now"},
+	{actionIncInterval, "+", contextUpdates, "Lengthen the refresh interval"},
+	{actionDecInterval, "-", contextUpdates, "Shorten the refresh interval"},
+	{actionErrors, "E", contextUpdates, "Show the log of failed queries"},
+	{actionStepForward, ".", contextPlayback, "Step forward"},
+	{actionStepBack, ",", contextPlayback, "Step back"},
+	{actionFaster, "]", contextPlayback, "Play faster"},
+	{actionSlower, "[", contextPlayback, "Play slower"},
+}
+
+// A keySpec identifies a key: a special key, or a rune if key is KeyRune.
+type keySpec struct {
+	key tcell.Key
+	ch  rune
+}
+
+// A Keymap maps keys to actions.
+type Keymap map[keySpec]string
+
+// DefaultKeymap returns the keymap of the default bindings.
+func DefaultKeymap() Keymap {
+	km := Keymap{}
+	for _, binding := range defaultBindings {
+		for _, name := range strings.Fields(binding.keys) {
+			spec, err := parseKey(name)
+			if err != nil {
+				panic(err)
+			}
+			km[spec] = binding.action
+		}
+	}
+	return km
+}
+
+// Bind binds actions to keys given as space-separated key names like
+// "Ctrl-F /". The keys replace all the existing keys of the action. Key names
+// are single characters, "Space" and tcell key names like "Enter", "PgDn" and
+// "Ctrl-L".
+func (km Keymap) Bind(bindings map[string]string) error {
+	actions := []string{}
+	for action := range bindings {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+
+	for _, action := range actions {
+		keys := bindings[action]
+		if !isAction(action) {
+			return fmt.Errorf("unknown action %q", action)
+		}
+
+		specs := []keySpec{}
+		for _, name := range strings.Fields(keys) {
+			spec, err := parseKey(name)
+			if err != nil {
+				return fmt.Errorf("key of %s: %s", action, err)
+			}
+			specs = append(specs, spec)
+		}
+
+		for spec, bound := range km {
+			if bound == action {
+				delete(km, spec)
+			}
+		}
+
+		for _, spec := range specs {
+			km[spec] = action
+		}
+	}
+	return nil
+}
+
+// Bindings returns the keys bound to each action as space-separated key names.
+func (km Keymap) Bindings() map[string]string {
+	names := map[string][]string{}
+	for spec, action := range km {
+		names[action] = append(names[action], spec.String())
+	}
+
+	bindings := map[string]string{}
+	for action, keys := range names {
+		sort.Strings(keys)
+		bindings[action] = strings.Join(keys, " ")
+	}
+	return bindings
+}
+
+// keysOf returns the names of the keys bound to an action. The default keys
+// come first in the default order.
+func (km Keymap) keysOf(action string) []string {
+	names := []string{}
+	seen := map[keySpec]bool{}
+
+	for _, binding := range defaultBindings {
+		if binding.action != action {
+			continue
+		}
+		for _, name := range strings.Fields(binding.keys) {
+			spec, _ := parseKey(name)
+			if km[spec] == action {
+				names = append(names, name)
+				seen[spec] = true
+			}
+		}
+	}
+
+	others := []string{}
+	for spec, bound := range km {
+		if bound == action && !seen[spec] {
+			others = append(others, spec.String())
+		}
+	}
+	sort.Strings(others)
+
+	return append(names, others...)
+}
+
+// keyOf returns the name of a key bound to an action, or "" if the action is
+// not bound.
+func (km Keymap) keyOf(action string) string {
+	if keys := km.keysOf(action); len(keys) > 0 {
+		return keys[0]
+	}
+	return ""
+}
+
+// action returns the action bound to the key of an event.
+func (km Keymap) action(ev *tcell.EventKey) string {
+	spec := keySpec{key: ev.Key()}
+	if ev.Key() == tcell.KeyRune {
+		spec.ch = ev.Rune()
+	}
+	return km[spec]
+}
+
+func isAction(name string) bool {
+	for _, binding := range defaultBindings {
+		if binding.action == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseKey parses a key name.
+func parseKey(name string) (keySpec, error) {
+	if name == "Space" {
+		return keySpec{tcell.KeyRune, ' '}, nil
+	}
+
+	if r := []rune(name); len(r) == 1 {
+		return keySpec{tcell.KeyRune, r[0]}, nil
+	}
+
+	for key, keyName := range tcell.KeyNames {
+		if strings.EqualFold(keyName, name) {
+			return keySpec{key: key}, nil
+		}
+	}
+
+	return keySpec{}, fmt.Errorf("unknown key %q", name)
+}
+
+func (spec keySpec) String() string {
+	if spec.key != tcell.KeyRune {
+		return tcell.KeyNames[spec.key]
+	}
+	if spec.ch == ' ' {
+		return "Space"
+	}
+	return string(spec.ch)
+}
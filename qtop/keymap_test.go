@@ -0,0 +1,115 @@
+package qtop
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gdamore/tcell"
+)
+
+func Test_parseKey(t *testing.T) {
+	testCases := []struct {
+		name string
+		spec keySpec
+	}{
+		{"q", keySpec{tcell.KeyRune, 'q'}},
+		{"Space", keySpec{tcell.KeyRune, ' '}},
+		{"Enter", keySpec{key: tcell.KeyEnter}},
+		{"pgdn", keySpec{key: tcell.KeyPgDn}},
+		{"Ctrl-L", keySpec{key: tcell.KeyCtrlL}},
+	}
+
+	for _, tc := range testCases {
+		spec, err := parseKey(tc.name)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", tc.name, err)
+			continue
+		}
+
+		if spec != tc.spec {
+			t.Errorf("%q: got %v, want %v", tc.name, spec, tc.spec)
+		}
+	}
+
+	if _, err := parseKey("Hyper-X"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func Test_Keymap_Bind(t *testing.T) {
+	km := DefaultKeymap()
+
+	if err := km.Bind(map[string]string{"filter": "F Ctrl-F"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	ev := tcell.NewEventKey(tcell.KeyRune, 'F', tcell.ModNone)
+	if action := km.action(ev); action != actionFilter {
+		t.Errorf("unexpected action of F: %q", action)
+	}
+
+	ev = tcell.NewEventKey(tcell.KeyCtrlF, 0, tcell.ModCtrl)
+	if action := km.action(ev); action != actionFilter {
+		t.Errorf("unexpected action of Ctrl-F: %q", action)
+	}
+
+	ev = tcell.NewEventKey(tcell.KeyRune, 'f', tcell.ModNone)
+	if action := km.action(ev); action != "" {
+		t.Errorf("old key is still bound to %q", action)
+	}
+
+	if err := km.Bind(map[string]string{"explode": "x"}); err == nil {
+		t.Error("expected error for unknown action")
+	}
+}
+
+func Test_Keymap_Bindings_RoundTrips(t *testing.T) {
+	km := Keymap{}
+	if err := km.Bind(DefaultKeymap().Bindings()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(km) != len(DefaultKeymap()) {
+		t.Errorf("unexpected number of keys: %d", len(km))
+	}
+}
+
+func Test_defaultBindings_AreDescribed(t *testing.T) {
+	seen := map[string]bool{}
+
+	for _, binding := range defaultBindings {
+		if seen[binding.action] {
+			t.Errorf("%s: listed twice", binding.action)
+		}
+		seen[binding.action] = true
+
+		if binding.context == "" || binding.desc == "" {
+			t.Errorf("%s: no description", binding.action)
+		}
+	}
+}
+
+func Test_Keymap_keysOf_ListsDefaultKeysFirst(t *testing.T) {
+	km := DefaultKeymap()
+
+	if keys := km.keysOf(actionQuit); !reflect.DeepEqual(keys, []string{"q", "Q"}) {
+		t.Errorf("unexpected keys: %q", keys)
+	}
+
+	if err := km.Bind(map[string]string{"quit": "x Ctrl-Q Q"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if keys := km.keysOf(actionQuit); !reflect.DeepEqual(keys, []string{"Q", "Ctrl-Q", "x"}) {
+		t.Errorf("unexpected keys: %q", keys)
+	}
+
+	if key := km.keyOf(actionQuit); key != "Q" {
+		t.Errorf("unexpected key: %q", key)
+	}
+
+	km.Bind(map[string]string{"help": ""})
+	if key := km.keyOf(actionHelp); key != "" {
+		t.Errorf("unbound action has key %q", key)
+	}
+}
@@ -0,0 +1,76 @@
+package qtop
+
+// bodyHeight returns the number of screen rows available for the main view,
+// excluding the row reserved at the bottom of the screen for the prompt, a
+// notice, errors or key hints.
+func (app *App) bodyHeight() int {
+	_, h := app.scr.Size()
+	return h - 1
+}
+
+// layout places the sections of the screen for the current state: the
+// viewports of the overlays and the lists, and the row of the job header. It
+// runs in the event loop before the screen model is built, so that drawing
+// never changes the App.
+func (app *App) layout() {
+	w, h := app.scr.Size()
+	body := app.bodyHeight()
+
+	app.header = -1
+
+	// Overlays cover the whole screen including the bottom row.
+	if p := app.panel; p != nil {
+		p.view.layout(1+yMargin, h-2-yMargin, len(p.lines))
+		return
+	}
+
+	if p := app.picker; p != nil {
+		p.view.layout(1+yMargin, h-2-yMargin, len(p.items))
+		p.view.move(p.cursor - p.view.cursor)
+		return
+	}
+
+	y := 0
+	if app.tabCount() > 1 {
+		y += 1 + yMargin
+	}
+
+	if app.showsMine() {
+		y += 1 + yMargin
+		app.header = y
+		y++
+		app.jobView.layout(y, body-y, len(app.mineRows()))
+		return
+	}
+
+	cluster := app.clusters[app.tab]
+	sum := cluster.Top.Current()
+	if sum == nil {
+		return
+	}
+
+	// Totals, filter, trends and legend
+	y++
+	if sum.Filter != "" {
+		y++
+	}
+	if makeTrendsModel(sum, cluster.Top, w) != nil {
+		y++
+	}
+	if app.legend {
+		y++
+	}
+	y += yMargin
+
+	// Rows left for the node and job lists, excluding the margin between them
+	// and the job header.
+	avail := body - y - yMargin - 1
+	nodeHeight, jobHeight := splitHeights(avail, len(sum.Nodes), len(sum.Jobs))
+
+	app.nodeView.layout(y, nodeHeight, len(sum.Nodes))
+	y += nodeHeight + yMargin
+
+	app.header = y
+	y++
+	app.jobView.layout(y, jobHeight, len(sum.Jobs))
+}
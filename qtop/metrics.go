@@ -0,0 +1,212 @@
+package qtop
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// WriteMetrics writes the state of the clusters to w in the Prometheus text
+// exposition format.
+func WriteMetrics(w io.Writer, clusters []Cluster) error {
+	mw := metricsWriter{w: bufio.NewWriter(w)}
+
+	mw.family("qtop_up", "Whether the last query to the server succeeded.")
+	for _, cluster := range clusters {
+		up := 1.0
+		if cluster.Top.Err() != nil {
+			up = 0
+		}
+		mw.sample("qtop_up", up, "cluster", cluster.Name)
+	}
+
+	mw.family("qtop_query_duration_seconds", "Time taken by the last query to the server.")
+	for _, cluster := range clusters {
+		mw.sample("qtop_query_duration_seconds", cluster.Top.Latency().Seconds(), "cluster", cluster.Name)
+	}
+
+	mw.family("qtop_last_update_timestamp_seconds", "Time of the last successful query to the server.")
+	for _, cluster := range clusters {
+		if snap := cluster.Top.Snapshot(); snap != nil {
+			ts := float64(snap.Time.UnixNano()) / 1e9
+			mw.sample("qtop_last_update_timestamp_seconds", ts, "cluster", cluster.Name)
+		}
+	}
+
+	mw.family("qtop_running_jobs", "Number of running jobs.")
+	for _, cluster := range clusters {
+		if sum := cluster.Top.Current(); sum != nil {
+			mw.sample("qtop_running_jobs", float64(sum.Cluster.RunningJobs), "cluster", cluster.Name)
+		}
+	}
+
+	mw.family("qtop_waiting_jobs", "Number of jobs waiting, held or exiting.")
+	for _, cluster := range clusters {
+		if sum := cluster.Top.Current(); sum != nil {
+			mw.sample("qtop_waiting_jobs", float64(sum.Cluster.WaitingJobs), "cluster", cluster.Name)
+		}
+	}
+
+	mw.family("qtop_used_slots", "Number of slots used by running jobs.")
+	for _, cluster := range clusters {
+		if sum := cluster.Top.Current(); sum != nil {
+			mw.sample("qtop_used_slots", float64(sum.Cluster.UsedSlots), "cluster", cluster.Name)
+		}
+	}
+
+	mw.family("qtop_free_slots", "Number of free slots on the nodes that are not down.")
+	for _, cluster := range clusters {
+		if sum := cluster.Top.Current(); sum != nil {
+			mw.sample("qtop_free_slots", float64(sum.Cluster.FreeSlots), "cluster", cluster.Name)
+		}
+	}
+
+	mw.family("qtop_node_used_slots", "Number of slots used by running jobs on the node.")
+	for _, cluster := range clusters {
+		if sum := cluster.Top.Current(); sum != nil {
+			for _, node := range sum.Nodes {
+				mw.sample("qtop_node_used_slots", float64(node.UsedSlots), "cluster", cluster.Name, "node", node.Name)
+			}
+		}
+	}
+
+	mw.family("qtop_node_free_slots", "Number of free slots on the node. Zero if the node is down.")
+	for _, cluster := range clusters {
+		if sum := cluster.Top.Current(); sum != nil {
+			for _, node := range sum.Nodes {
+				free := 0
+				if node.Active {
+					free = node.AvailSlots - node.UsedSlots
+				}
+				mw.sample("qtop_node_free_slots", float64(free), "cluster", cluster.Name, "node", node.Name)
+			}
+		}
+	}
+
+	mw.family("qtop_nodes", "Number of nodes in each state.")
+	for _, cluster := range clusters {
+		if snap := cluster.Top.Snapshot(); snap != nil {
+			counts := map[string]int{}
+			for _, node := range snap.Nodes {
+				counts[node.State]++
+			}
+			for _, state := range sortedKeys(counts) {
+				mw.sample("qtop_nodes", float64(counts[state]), "cluster", cluster.Name, "state", state)
+			}
+		}
+	}
+
+	mw.family("qtop_queue_jobs", "Number of jobs in the queue by job state.")
+	for _, cluster := range clusters {
+		if snap := cluster.Top.Snapshot(); snap != nil {
+			type key struct{ queue, state string }
+			counts := map[key]int{}
+			for _, job := range snap.Jobs {
+				counts[key{job.Queue, job.State}]++
+			}
+
+			keys := []key{}
+			for k := range counts {
+				keys = append(keys, k)
+			}
+			sort.Slice(keys, func(i, j int) bool {
+				if keys[i].queue != keys[j].queue {
+					return keys[i].queue < keys[j].queue
+				}
+				return keys[i].state < keys[j].state
+			})
+
+			for _, k := range keys {
+				mw.sample("qtop_queue_jobs", float64(counts[k]), "cluster", cluster.Name, "queue", k.queue, "state", k.state)
+			}
+		}
+	}
+
+	mw.family("qtop_queue_used_slots", "Number of slots used by running jobs in the queue.")
+	for _, cluster := range clusters {
+		if snap := cluster.Top.Snapshot(); snap != nil {
+			slots := map[string]int{}
+			for _, job := range snap.Jobs {
+				if job.State == "R" {
+					slots[job.Queue] += len(job.ExecSlots)
+				} else if _, ok := slots[job.Queue]; !ok {
+					slots[job.Queue] = 0
+				}
+			}
+			for _, queue := range sortedKeys(slots) {
+				mw.sample("qtop_queue_used_slots", float64(slots[queue]), "cluster", cluster.Name, "queue", queue)
+			}
+		}
+	}
+
+	mw.family("qtop_user_used_slots", "Number of slots used by running jobs of the user.")
+	for _, cluster := range clusters {
+		if snap := cluster.Top.Snapshot(); snap != nil {
+			slots := map[string]int{}
+			for _, job := range snap.Jobs {
+				user := abbrevUsername(job.Owner)
+				if job.State == "R" {
+					slots[user] += len(job.ExecSlots)
+				} else if _, ok := slots[user]; !ok {
+					slots[user] = 0
+				}
+			}
+			for _, user := range sortedKeys(slots) {
+				mw.sample("qtop_user_used_slots", float64(slots[user]), "cluster", cluster.Name, "user", user)
+			}
+		}
+	}
+
+	return mw.flush()
+}
+
+// metricsWriter writes metrics in the Prometheus text format. It remembers the
+// first write error and ignores subsequent writes.
+type metricsWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (mw *metricsWriter) family(name, help string) {
+	mw.printf("# HELP %s %s\n", name, help)
+	mw.printf("# TYPE %s gauge\n", name)
+}
+
+func (mw *metricsWriter) sample(name string, value float64, labels ...string) {
+	pairs := []string{}
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", labels[i], escapeLabel(labels[i+1])))
+	}
+	mw.printf("%s{%s} %g\n", name, strings.Join(pairs, ","), value)
+}
+
+func (mw *metricsWriter) printf(format string, args ...interface{}) {
+	if mw.err != nil {
+		return
+	}
+	_, mw.err = fmt.Fprintf(mw.w, format, args...)
+}
+
+func (mw *metricsWriter) flush() error {
+	if mw.err != nil {
+		return mw.err
+	}
+	return mw.w.Flush()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,53 @@
+package qtop
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func Test_WriteMetrics_WritesSamples(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := WriteMetrics(&buf, testClusters()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []string{
+		`# TYPE qtop_running_jobs gauge`,
+		`qtop_up{cluster="test"} 1`,
+		`qtop_running_jobs{cluster="test"} 1`,
+		`qtop_waiting_jobs{cluster="test"} 1`,
+		`qtop_node_used_slots{cluster="test",node="node1"} 2`,
+		`qtop_node_free_slots{cluster="test",node="node2"} 0`,
+		`qtop_nodes{cluster="test",state="down"} 1`,
+		`qtop_queue_jobs{cluster="test",queue="batch",state="Q"} 1`,
+		`qtop_queue_used_slots{cluster="test",queue="batch"} 2`,
+		`qtop_user_used_slots{cluster="test",user="alice"} 2`,
+	}
+
+	lines := strings.Split(buf.String(), "\n")
+
+	for _, line := range expected {
+		found := false
+		for _, actual := range lines {
+			if actual == line {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			t.Errorf("missing line %q", line)
+		}
+	}
+}
+
+func Test_escapeLabel(t *testing.T) {
+	actual := escapeLabel("a\"b\\c\nd")
+	expected := `a\"b\\c\nd`
+
+	if actual != expected {
+		t.Errorf("unexpected result: got %q, want %q", actual, expected)
+	}
+}
@@ -0,0 +1,672 @@
+package qtop
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell"
+)
+
+// Key hints shown at the bottom of the overlays.
+const (
+	panelHint  = "Esc: close  Up/Down/PgUp/PgDn: scroll"
+	pickerHint = "Space: show/hide  J/K: move  </>: width  =: reset  Enter: apply  Esc: cancel"
+)
+
+// A screenModel describes everything shown on the screen at a moment. The App
+// builds it from its state after laying out the screen, and a renderer draws
+// it without looking back at the App.
+type screenModel struct {
+	// overlay, if not nil, covers the whole screen and nothing else is shown.
+	overlay *overlayModel
+
+	// bottom is the content of the row at the bottom of the screen.
+	bottom bottomModel
+
+	// tabs lists the names of the tabs if there is more than one, and tab is
+	// the index of the current tab.
+	tabs []string
+	tab  int
+
+	// clock is the current time, or the playback position and status while
+	// replaying a recording. status is the age of the shown data drawn in the
+	// style of statusRole.
+	clock      string
+	status     string
+	statusRole string
+
+	// me is the name of the current user, whose jobs are highlighted.
+	me string
+
+	// Exactly one of the following is set: the combined tab of the current
+	// user's jobs, the tab of a cluster, or the status of a cluster with no
+	// data yet.
+	mine    *mineModel
+	cluster *clusterModel
+	loading string
+}
+
+// An overlayModel is a scrollable list of lines covering the whole screen,
+// such as a detail panel or the column picker.
+type overlayModel struct {
+	title string
+	lines [][]span
+	view  viewport
+
+	// cursor is true if the selected line is highlighted.
+	cursor bool
+
+	hint string
+}
+
+// A bottomModel is the content of the bottom row: the prompt, a notice, the
+// failed queries or the key hints, whichever is set first.
+type bottomModel struct {
+	prompt *promptModel
+	notice string
+	errors string
+	hints  []keyHint
+}
+
+// A promptModel is the state of a prompt being edited.
+type promptModel struct {
+	label string
+	text  string
+	err   string
+}
+
+// A keyHint is a key shown in the hint bar with a short label.
+type keyHint struct {
+	key   string
+	label string
+}
+
+// A mineModel is the combined tab listing the current user's jobs in all the
+// clusters.
+type mineModel struct {
+	totals string
+	jobs   jobListModel
+}
+
+// A clusterModel is the tab of a cluster.
+type clusterModel struct {
+	totals string
+	filter string
+
+	// trends is nil if no trend is shown.
+	trends *trendsModel
+
+	// legend lists the owners using slots if the legend is shown.
+	legend      []legendItem
+	legendShown bool
+
+	nodes nodeListModel
+	jobs  jobListModel
+}
+
+// A trendsModel is the sparklines of the used slots and the waiting jobs of a
+// cluster, each drawn in width columns.
+type trendsModel struct {
+	width int
+
+	usage   []float64
+	waiting []float64
+
+	// waitingMax is the height of the waiting sparkline.
+	waitingMax float64
+
+	// slots and waitingCount are the current values drawn after the lines.
+	slots        string
+	waitingCount string
+}
+
+// A legendItem is an owner in the legend with the number of used slots.
+type legendItem struct {
+	owner string
+	slots int
+}
+
+// A listModel is the state of a list shown in a viewport.
+type listModel struct {
+	view viewport
+
+	// focused is true if the focus bar is drawn, and cursor is true if the
+	// selected row is highlighted.
+	focused bool
+	cursor  bool
+
+	// hits is the set of the visible rows matching the search query.
+	hits map[int]bool
+}
+
+// A nodeListModel is the list of the nodes of a cluster.
+type nodeListModel struct {
+	listModel
+
+	// nodes are the visible nodes and trends are their usage trends.
+	nodes  []NodeSummary
+	trends [][]float64
+
+	// nameWidth fits the names of all the nodes, and trendWidth is the
+	// width of the sparklines or zero if none is drawn.
+	nameWidth  int
+	trendWidth int
+}
+
+// A jobListModel is a list of jobs with a header.
+type jobListModel struct {
+	listModel
+
+	header  int
+	columns []jobColumn
+	order   JobOrder
+
+	// rows are the visible rows.
+	rows []jobListRow
+}
+
+// A jobListRow is a job or, in the combined tab, the heading of a cluster.
+type jobListRow struct {
+	heading string
+	job     *jobRow
+}
+
+// model builds the screen model of the current state.
+func (app *App) model() *screenModel {
+	w, _ := app.scr.Size()
+	now := app.clock()
+
+	m := &screenModel{me: currentUsername()}
+
+	if p := app.panel; p != nil {
+		m.overlay = &overlayModel{
+			title: p.title,
+			lines: p.lines,
+			view:  p.view,
+			hint:  panelHint,
+		}
+		return m
+	}
+
+	if p := app.picker; p != nil {
+		m.overlay = app.pickerModel(p)
+		return m
+	}
+
+	m.bottom = app.bottomModel(now)
+
+	if app.tabCount() > 1 {
+		for _, cluster := range app.clusters {
+			m.tabs = append(m.tabs, cluster.Name)
+		}
+		m.tabs = append(m.tabs, "mine")
+		m.tab = app.tab
+	}
+
+	m.clock = now.Format(time.Stamp)
+	if player := app.config.Player; player != nil {
+		m.clock = player.Status() + "  " + player.Time().Format(time.Stamp)
+	}
+	m.status, m.statusRole = app.dataStatus(now)
+
+	if app.showsMine() {
+		m.mine = app.mineModel(m.me)
+		return m
+	}
+
+	cluster := app.clusters[app.tab]
+	sum := cluster.Top.Current()
+	if sum == nil {
+		m.loading = app.loadingStatus(app.tab)
+		return m
+	}
+
+	m.cluster = app.clusterModel(cluster, sum, w)
+	return m
+}
+
+// pickerModel returns the column picker as an overlay.
+func (app *App) pickerModel(p *columnPicker) *overlayModel {
+	lines := [][]span{}
+
+	for _, item := range p.items {
+		mark := "[ ]"
+		style := app.theme.style(roleDim)
+		if item.shown {
+			mark = "[x]"
+			style = tcell.StyleDefault
+		}
+
+		width := fmt.Sprint(item.col.width)
+		if item.col.flex > 0 {
+			width += "+"
+		}
+
+		line := fmt.Sprintf("%s %-10s %-8s %4s", mark, item.col.label, item.col.name, width)
+		lines = append(lines, []span{{line, style}})
+	}
+
+	return &overlayModel{
+		title:  "Columns",
+		lines:  lines,
+		view:   p.view,
+		cursor: true,
+		hint:   pickerHint,
+	}
+}
+
+// bottomModel returns the content of the bottom row at time now.
+func (app *App) bottomModel(now time.Time) bottomModel {
+	if p := app.prompt; p != nil {
+		return bottomModel{prompt: &promptModel{p.label, string(p.text), p.err}}
+	}
+
+	if app.notice != "" {
+		return bottomModel{notice: app.notice}
+	}
+
+	if status := app.errorStatus(now); status != "" {
+		return bottomModel{errors: status}
+	}
+
+	hints := []keyHint{}
+	for _, hint := range hintActions {
+		if key := app.keymap.keyOf(hint.action); key != "" {
+			hints = append(hints, keyHint{key, hint.label})
+		}
+	}
+	return bottomModel{hints: hints}
+}
+
+// clusterModel returns the tab of a cluster with summary sum on a screen w
+// columns wide.
+func (app *App) clusterModel(cluster Cluster, sum *Summary, w int) *clusterModel {
+	c := &clusterModel{
+		totals:      formatTotals(sum),
+		filter:      sum.Filter,
+		trends:      makeTrendsModel(sum, cluster.Top, w),
+		legendShown: app.legend,
+		nodes:       app.nodeListModel(sum.Nodes, cluster.Top),
+	}
+
+	if app.legend {
+		c.legend = makeLegend(sum.Nodes)
+	}
+
+	jobs := sum.Jobs
+	c.jobs = app.jobListModel(&app.jobView, app.focus == paneJobs, app.focus == paneJobs, func(i int) bool {
+		return matchJobQuery(jobs[i], app.search)
+	})
+
+	from, to := visibleRange(&app.jobView)
+	for _, job := range jobs[from:to] {
+		row := app.jobRow(job, cluster)
+		c.jobs.rows = append(c.jobs.rows, jobListRow{job: &row})
+	}
+
+	return c
+}
+
+// makeTrendsModel returns the sparklines of a cluster fitting a screen w
+// columns wide. It returns nil if the cluster keeps no history or the screen
+// is too narrow.
+func makeTrendsModel(sum *Summary, top *Top, w int) *trendsModel {
+	size := top.Options().History
+	t := top.trends()
+	if size == 0 || len(t.usage) == 0 {
+		return nil
+	}
+
+	slots := fmt.Sprintf(" %d/%d", sum.Cluster.UsedSlots, sum.Capacity())
+	waiting := fmt.Sprintf(" %d", sum.Cluster.WaitingJobs)
+
+	width := (w - 2*xMargin - textWidth("slots "+slots+"  waiting "+waiting)) / 2
+	if width > size {
+		width = size
+	}
+	if width < 1 {
+		return nil
+	}
+
+	return &trendsModel{
+		width:        width,
+		usage:        t.usage,
+		waiting:      t.waiting,
+		waitingMax:   seriesMax(t.waiting),
+		slots:        slots,
+		waitingCount: waiting,
+	}
+}
+
+// makeLegend lists the owners using slots on the nodes in the descending
+// order of the number of used slots.
+func makeLegend(nodes []NodeSummary) []legendItem {
+	usage := map[string]int{}
+	for _, node := range nodes {
+		for _, ownerSum := range node.Owners {
+			usage[abbrevUsername(ownerSum.Owner)] += ownerSum.Occupancy
+		}
+	}
+
+	owners := sortedKeys(usage)
+	sort.SliceStable(owners, func(i, j int) bool {
+		return usage[owners[i]] > usage[owners[j]]
+	})
+
+	legend := []legendItem{}
+	for _, owner := range owners {
+		legend = append(legend, legendItem{owner, usage[owner]})
+	}
+	return legend
+}
+
+// nodeListModel returns the list of the nodes of a cluster.
+func (app *App) nodeListModel(nodes []NodeSummary, top *Top) nodeListModel {
+	focused := app.focus == paneNodes
+
+	l := nodeListModel{
+		listModel: app.listModel(&app.nodeView, focused, focused, func(i int) bool {
+			return matchNodeQuery(nodes[i], app.search)
+		}),
+		trendWidth: nodeTrendWidth,
+	}
+
+	if size := top.Options().History; size < l.trendWidth {
+		l.trendWidth = size
+	}
+
+	for _, node := range nodes {
+		if n := textWidth(node.Name); n > l.nameWidth {
+			l.nameWidth = n
+		}
+	}
+
+	trends := top.trends()
+	from, to := visibleRange(&app.nodeView)
+	for _, node := range nodes[from:to] {
+		l.nodes = append(l.nodes, node)
+		l.trends = append(l.trends, trends.nodes[node.Name])
+	}
+
+	return l
+}
+
+// mineModel returns the combined tab of the jobs of user me.
+func (app *App) mineModel(me string) *mineModel {
+	running := 0
+	waiting := 0
+	for _, cluster := range app.clusters {
+		sum := cluster.Top.Current()
+		if sum == nil {
+			continue
+		}
+
+		for _, job := range sum.Jobs {
+			if abbrevUsername(job.Owner) != me {
+				continue
+			}
+			switch job.State {
+			case "C":
+			case "R":
+				running += job.Count
+			default:
+				waiting += job.Count
+			}
+		}
+	}
+
+	m := &mineModel{
+		totals: fmt.Sprintf(
+			"%d running, %d waiting in %d clusters",
+			running,
+			waiting,
+			len(app.clusters),
+		),
+	}
+
+	rows := app.mineRows()
+	m.jobs = app.jobListModel(&app.jobView, false, true, func(i int) bool {
+		return rows[i].job != nil && matchJobQuery(*rows[i].job, app.search)
+	})
+
+	from, to := visibleRange(&app.jobView)
+	for _, row := range rows[from:to] {
+		cluster := app.clusters[row.cluster]
+
+		if row.job != nil {
+			job := app.jobRow(*row.job, cluster)
+			m.jobs.rows = append(m.jobs.rows, jobListRow{job: &job})
+			continue
+		}
+
+		heading := app.loadingStatus(row.cluster)
+		if sum := cluster.Top.Current(); sum != nil {
+			heading = cluster.Name + ": " + formatTotals(sum)
+		}
+		m.jobs.rows = append(m.jobs.rows, jobListRow{heading: heading})
+	}
+
+	return m
+}
+
+// jobListModel returns a job list shown in view without the rows.
+func (app *App) jobListModel(view *viewport, focused, cursor bool, match func(i int) bool) jobListModel {
+	return jobListModel{
+		listModel: app.listModel(view, focused, cursor, match),
+		header:    app.header,
+		columns:   app.columns,
+		order:     app.jobOrder(),
+	}
+}
+
+// listModel returns a list shown in view. match tests the row at given index
+// against the search query.
+func (app *App) listModel(view *viewport, focused, cursor bool, match func(i int) bool) listModel {
+	l := listModel{
+		view:    *view,
+		focused: focused,
+		cursor:  cursor,
+	}
+
+	if app.search != "" {
+		l.hits = map[int]bool{}
+
+		from, to := visibleRange(view)
+		for i := from; i < to; i++ {
+			if match(i) {
+				l.hits[i] = true
+			}
+		}
+	}
+
+	return l
+}
+
+// visibleRange returns the range of the indices of the rows visible in view.
+func visibleRange(view *viewport) (int, int) {
+	to := view.offset + view.rows()
+	if to > view.total {
+		to = view.total
+	}
+	if to < view.offset {
+		to = view.offset
+	}
+	return view.offset, to
+}
+
+// A mineRow is a row in the combined list of the current user's jobs: either a
+// heading of a cluster or a job in the cluster.
+type mineRow struct {
+	cluster int
+	job     *JobSummary
+}
+
+// mineRows lists the rows of the combined tab. Each cluster is shown as a
+// heading row followed by job rows.
+func (app *App) mineRows() []mineRow {
+	me := currentUsername()
+	rows := []mineRow{}
+
+	for i, cluster := range app.clusters {
+		rows = append(rows, mineRow{cluster: i})
+
+		sum := cluster.Top.Current()
+		if sum == nil {
+			continue
+		}
+
+		jobs := sum.Jobs
+		for j := range jobs {
+			if abbrevUsername(jobs[j].Owner) == me {
+				rows = append(rows, mineRow{cluster: i, job: &jobs[j]})
+			}
+		}
+	}
+
+	return rows
+}
+
+// jobRow returns the row of a job group in the current summary of a cluster.
+func (app *App) jobRow(job JobSummary, cluster Cluster) jobRow {
+	me := currentUsername()
+	return jobRow{
+		job:   job,
+		now:   snapshotTime(cluster),
+		mine:  abbrevUsername(job.Owner) == me,
+		trend: cluster.Top.trends().job(job),
+	}
+}
+
+// loadingStatus describes the i-th cluster which has no data yet.
+func (app *App) loadingStatus(i int) string {
+	cluster := app.clusters[i]
+	if cluster.Top.Err() != nil && !app.pollers[i].fetching {
+		return "No data from " + cluster.Name
+	}
+	return "Querying " + cluster.Name + "…"
+}
+
+// errorStatus describes the failed last queries of the clusters shown in the
+// current tab with the countdowns to the retries. It returns "" if no query
+// has failed.
+func (app *App) errorStatus(now time.Time) string {
+	failures := []string{}
+
+	for _, i := range app.shownClusters() {
+		err := app.clusters[i].Top.Err()
+		if err == nil {
+			continue
+		}
+
+		retry := "retrying…"
+		if p := app.pollers[i]; !p.fetching {
+			retry = "retry in " + formatDuration(p.next.Sub(now))
+		}
+		failures = append(failures, fmt.Sprintf("%s: %s (%s)", app.clusters[i].Name, err, retry))
+	}
+
+	if len(failures) == 0 {
+		return ""
+	}
+
+	status := strings.Join(failures, "; ")
+	if key := app.keymap.keyOf(actionErrors); key != "" {
+		status = key + ": errors  " + status
+	}
+	return status
+}
+
+// shownClusters returns the indices of the clusters shown in the current tab.
+func (app *App) shownClusters() []int {
+	if !app.showsMine() {
+		return []int{app.tab}
+	}
+
+	indices := []int{}
+	for i := range app.clusters {
+		indices = append(indices, i)
+	}
+	return indices
+}
+
+// dataStatus returns the age of the shown data at time now and its style
+// role, which marks stale data. The age is prefixed with a spinner while
+// querying.
+func (app *App) dataStatus(now time.Time) (string, string) {
+	info := []string{}
+	role := roleDim
+
+	// The age of recorded data is meaningless while replaying, and the
+	// playback drives the queries.
+	if app.config.Player == nil {
+		if age, ok := app.dataAge(now); ok {
+			info = append(info, formatDuration(age)+" ago")
+			if age > staleIntervals*app.config.Interval {
+				role = roleNotice
+			}
+		}
+
+		if app.paused {
+			info = append(info, "paused")
+			role = roleNotice
+		} else if next, ok := app.nextRefresh(now); ok {
+			// Round up so that the countdown ends at 1s.
+			info = append(info, "next "+formatDuration(next+time.Second-1))
+		}
+	}
+
+	status := strings.Join(info, ", ")
+	if app.fetching() {
+		status = strings.TrimSpace(string(spinnerFrames[app.frame%len(spinnerFrames)]) + " " + status)
+	}
+	return status, role
+}
+
+// dataAge returns the age of the oldest snapshot shown in the current tab at
+// time now. It returns false if no snapshot is shown.
+func (app *App) dataAge(now time.Time) (time.Duration, bool) {
+	oldest := time.Time{}
+	for _, i := range app.shownClusters() {
+		t := snapshotTime(app.clusters[i])
+		if !t.IsZero() && (oldest.IsZero() || t.Before(oldest)) {
+			oldest = t
+		}
+	}
+
+	if oldest.IsZero() {
+		return 0, false
+	}
+	return now.Sub(oldest), true
+}
+
+// nextRefresh returns the time left until the next scheduled query of the
+// clusters shown in the current tab. It returns false if all of them are being
+// queried.
+func (app *App) nextRefresh(now time.Time) (time.Duration, bool) {
+	next := time.Duration(0)
+	found := false
+
+	for _, i := range app.shownClusters() {
+		p := app.pollers[i]
+		if p.fetching {
+			continue
+		}
+		if d := p.next.Sub(now); !found || d < next {
+			next = d
+			found = true
+		}
+	}
+
+	return next, found
+}
+
+// snapshotTime returns the time of the current snapshot of a cluster, or the
+// zero time if no snapshot is available.
+func snapshotTime(cluster Cluster) time.Time {
+	if snap := cluster.Top.Snapshot(); snap != nil {
+		return snap.Time
+	}
+	return time.Time{}
+}
@@ -0,0 +1,171 @@
+package qtop
+
+import (
+	"time"
+
+	"github.com/gdamore/tcell"
+)
+
+// Number of rows scrolled by a mouse wheel event.
+const wheelStep = 3
+
+// doubleClickTime is the longest interval between the two clicks of a
+// double-click.
+const doubleClickTime = 400 * time.Millisecond
+
+// A click is a press of the primary mouse button.
+type click struct {
+	time time.Time
+	y    int
+}
+
+// handleMouse processes a mouse event. The wheel scrolls the section under the
+// pointer. A click selects a row or sorts the jobs by the clicked column, and
+// a double-click opens the details of the row. Mouse events are ignored while
+// a prompt is open, as the prompt takes all the keys.
+func (app *App) handleMouse(ev *tcell.EventMouse) {
+	x, y := ev.Position()
+
+	// Terminals report the held buttons on every event, so a click is the
+	// moment the button goes down.
+	buttons := ev.Buttons() &^ (tcell.WheelUp | tcell.WheelDown)
+	pressed := buttons &^ app.buttons
+	app.buttons = buttons
+
+	if app.prompt != nil {
+		return
+	}
+
+	switch {
+	case ev.Buttons()&tcell.WheelUp != 0:
+		app.scrollAt(y, -wheelStep)
+
+	case ev.Buttons()&tcell.WheelDown != 0:
+		app.scrollAt(y, wheelStep)
+
+	case pressed&tcell.Button1 != 0:
+		app.notice = ""
+		app.clickAt(x, y, ev.When())
+
+	default:
+		return
+	}
+
+	app.redraw()
+}
+
+// scrollAt scrolls the section at screen row y by n rows.
+func (app *App) scrollAt(y, n int) {
+	if app.panel != nil {
+		app.panel.view.scroll(n)
+		return
+	}
+
+	if app.picker != nil {
+		app.picker.moveCursor(n)
+		return
+	}
+
+	view := &app.jobView
+	if app.nodeView.contains(y) {
+		view = &app.nodeView
+	}
+	view.scroll(n)
+}
+
+// clickAt handles a click at screen position (x, y) at given time.
+func (app *App) clickAt(x, y int, t time.Time) {
+	double := y == app.lastClick.y && t.Sub(app.lastClick.time) < doubleClickTime
+
+	// The second click of a double-click does not start another one.
+	if double {
+		app.lastClick = click{}
+	} else {
+		app.lastClick = click{t, y}
+	}
+
+	if app.panel != nil {
+		return
+	}
+
+	if app.picker != nil {
+		p := app.picker
+		if row, ok := rowAt(&p.view, y); ok {
+			p.cursor = row
+			if double {
+				p.items[row].shown = !p.items[row].shown
+			}
+		}
+		return
+	}
+
+	if y == app.header {
+		app.sortByColumnAt(x)
+		return
+	}
+
+	for _, section := range []struct {
+		pane pane
+		view *viewport
+	}{
+		{paneNodes, &app.nodeView},
+		{paneJobs, &app.jobView},
+	} {
+		row, ok := rowAt(section.view, y)
+		if !ok {
+			continue
+		}
+
+		app.focus = section.pane
+		section.view.cursor = row
+		if double {
+			app.openSelected()
+		}
+		return
+	}
+}
+
+// rowAt returns the index of the list row shown at screen row y of view. It
+// returns false if no list row is shown there.
+func rowAt(view *viewport, y int) (int, bool) {
+	if !view.contains(y) || y-view.top >= view.rows() {
+		return 0, false
+	}
+
+	row := view.offset + y - view.top
+	if row >= view.total {
+		return 0, false
+	}
+	return row, true
+}
+
+// sortByColumnAt sorts the jobs by the column at screen column x of the job
+// header. Clicking the current sort column reverses the order.
+func (app *App) sortByColumnAt(x int) {
+	w, _ := app.scr.Size()
+	widths := layoutColumns(app.columns, w)
+
+	// The separator after a column belongs to the column.
+	left := xMargin
+	for i, col := range app.columns {
+		right := left + widths[i] + 1
+		if x < left || x >= right {
+			left = right
+			continue
+		}
+
+		if col.key == sortNone {
+			app.notice = "cannot sort by " + col.name
+			return
+		}
+
+		order := app.jobOrder()
+		if order.Key == col.key {
+			order = order.Reverse()
+		} else {
+			order.Key = col.key
+		}
+		app.setJobOrder(order)
+		return
+	}
+}
@@ -0,0 +1,148 @@
+package qtop
+
+import (
+	"testing"
+
+	"github.com/gdamore/tcell"
+)
+
+func newMouseTestApp(t *testing.T) *App {
+	scr := newTestScreen(t, 60, 20)
+	app := NewApp(testClusters(), scr, Config{
+		Columns: []string{"user", "job", "state", "wait"},
+	})
+	app.redraw()
+	return app
+}
+
+func clickAt(app *App, x, y int) {
+	app.handleMouse(tcell.NewEventMouse(x, y, tcell.Button1, tcell.ModNone))
+	app.handleMouse(tcell.NewEventMouse(x, y, tcell.ButtonNone, tcell.ModNone))
+}
+
+func Test_App_ClickSelectsRow(t *testing.T) {
+	app := newMouseTestApp(t)
+	defer app.scr.Fini()
+
+	if app.jobView.total < 2 {
+		t.Fatalf("unexpected number of jobs: %d", app.jobView.total)
+	}
+
+	clickAt(app, 10, app.jobView.top+1)
+	if app.focus != paneJobs || app.jobView.cursor != 1 {
+		t.Errorf("job is not selected: focus %d, cursor %d", app.focus, app.jobView.cursor)
+	}
+
+	clickAt(app, 10, app.nodeView.top+1)
+	if app.focus != paneNodes || app.nodeView.cursor != 1 {
+		t.Errorf("node is not selected: focus %d, cursor %d", app.focus, app.nodeView.cursor)
+	}
+
+	clickAt(app, 10, app.jobView.top+app.jobView.total)
+	if app.focus != paneNodes {
+		t.Errorf("click below the list changes focus")
+	}
+}
+
+func Test_App_IgnoresMouseWhilePrompting(t *testing.T) {
+	app := newMouseTestApp(t)
+	defer app.scr.Fini()
+
+	app.openSearchPrompt()
+	if app.prompt == nil {
+		t.Fatalf("prompt is not opened")
+	}
+
+	y := app.jobView.top + 1
+	clickAt(app, 10, y)
+	clickAt(app, 10, y)
+	if app.jobView.cursor != 0 || app.panel != nil {
+		t.Errorf("click is handled while prompting: cursor %d", app.jobView.cursor)
+	}
+
+	app.handleMouse(tcell.NewEventMouse(10, y, tcell.WheelDown, tcell.ModNone))
+	if app.jobView.offset != 0 {
+		t.Errorf("wheel is handled while prompting")
+	}
+}
+
+func Test_App_ClickHeaderSorts(t *testing.T) {
+	app := newMouseTestApp(t)
+	defer app.scr.Fini()
+
+	y := app.jobView.top - 1
+	if app.header != y {
+		t.Fatalf("unexpected header row: %d", app.header)
+	}
+
+	// Columns: user (2-12), job (13-...), state, wait.
+	clickAt(app, 14, y)
+	if order := app.jobOrder(); order != (JobOrder{Key: SortName}) {
+		t.Errorf("unexpected order: %+v", order)
+	}
+
+	clickAt(app, 14, y)
+	if order := app.jobOrder(); order != (JobOrder{Key: SortName, Descending: true}) {
+		t.Errorf("order is not reversed: %+v", order)
+	}
+
+	clickAt(app, 3, y)
+	if order := app.jobOrder(); order != (JobOrder{Key: SortOwner, Descending: true}) {
+		t.Errorf("unexpected order: %+v", order)
+	}
+
+	clickAt(app, 57, y)
+	if app.notice != "cannot sort by wait" {
+		t.Errorf("unexpected notice: %q", app.notice)
+	}
+}
+
+func Test_App_DoubleClickOpensDetail(t *testing.T) {
+	app := newMouseTestApp(t)
+	defer app.scr.Fini()
+
+	// Dragging with the button held is not another click.
+	y := app.jobView.top
+	app.handleMouse(tcell.NewEventMouse(10, y, tcell.Button1, tcell.ModNone))
+	app.handleMouse(tcell.NewEventMouse(11, y, tcell.Button1, tcell.ModNone))
+	app.handleMouse(tcell.NewEventMouse(11, y, tcell.ButtonNone, tcell.ModNone))
+	if app.panel != nil {
+		t.Fatalf("detail is opened by a single click")
+	}
+
+	clickAt(app, 10, y)
+	if app.panel == nil {
+		t.Fatalf("detail is not opened by a double-click")
+	}
+
+	lines := len(app.panel.lines)
+	app.handleMouse(tcell.NewEventMouse(10, y, tcell.WheelDown, tcell.ModNone))
+	if app.panel.view.offset == 0 && lines > app.panel.view.rows() {
+		t.Errorf("wheel does not scroll the detail")
+	}
+}
+
+func Test_rowAt(t *testing.T) {
+	view := viewport{}
+	view.layout(5, 4, 10)
+	view.scroll(2)
+
+	testCases := []struct {
+		y   int
+		row int
+		ok  bool
+	}{
+		{4, 0, false},
+		{5, 2, true},
+		{7, 4, true},
+		{8, 0, false},
+		{9, 0, false},
+	}
+
+	for _, tc := range testCases {
+		row, ok := rowAt(&view, tc.y)
+		if row != tc.row || ok != tc.ok {
+			t.Errorf("rowAt(%d) = %d, %v, want %d, %v", tc.y, row, ok, tc.row, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package qtop
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Output formats supported by WriteSummary.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+// Tables selectable for CSV output.
+const (
+	TableCluster = "cluster"
+	TableNodes   = "nodes"
+	TableJobs    = "jobs"
+)
+
+// WriteSummary writes the current summaries of the clusters to w in given
+// format. table selects the table to write in CSV format and is ignored in the
+// other formats.
+func WriteSummary(w io.Writer, clusters []Cluster, format, table string) error {
+	switch format {
+	case FormatText:
+		return WriteText(w, clusters)
+
+	case FormatJSON:
+		return WriteJSON(w, clusters)
+
+	case FormatCSV:
+		return WriteCSV(w, clusters, table)
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+// WriteText writes the summaries as human-readable aligned text.
+func WriteText(w io.Writer, clusters []Cluster) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 1, ' ', 0)
+
+	for i, cluster := range clusters {
+		sum := cluster.Top.Current()
+
+		if i > 0 {
+			fmt.Fprintln(tw)
+		}
+
+		fmt.Fprintf(tw, "%s: %s\n", cluster.Name, formatTotals(sum))
+		if sum.Filter != "" {
+			fmt.Fprintf(tw, "filter: %s\n", sum.Filter)
+		}
+		fmt.Fprintln(tw)
+
+		fmt.Fprintln(tw, "NODE\tUSED\tAVAIL\tOWNERS")
+		for _, node := range sum.Nodes {
+			used := strconv.Itoa(node.UsedSlots)
+			if !node.Active {
+				used = "-"
+			}
+
+			owners := []string{}
+			for _, owner := range node.Owners {
+				owners = append(owners, fmt.Sprintf("%d:%s", owner.Occupancy, abbrevUsername(owner.Owner)))
+			}
+
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", node.Name, used, node.AvailSlots, strings.Join(owners, " "))
+		}
+		fmt.Fprintln(tw)
+
+		fmt.Fprintln(tw, "USER\tJOB\tS\tNJOB\tNCPU\tCPU%\tMAX TIME\tJID")
+		for _, job := range sum.Jobs {
+			fmt.Fprintf(
+				tw,
+				"%s\t%s\t%s\t%d\t%d\t%.1f\t%s\t%s\n",
+				abbrevUsername(job.Owner),
+				job.Name,
+				job.State,
+				job.Count,
+				job.Occupancy,
+				job.CPUUsage*100,
+				strings.TrimSpace(formatClock(job.MaxWalltime)),
+				compressIDs(job.IDs),
+			)
+		}
+	}
+
+	return tw.Flush()
+}
+
+// formatTotals formats the job and slot totals of a cluster. The totals of a
+// filtered summary are marked as such and followed by the global totals.
+func formatTotals(sum *Summary) string {
+	if sum.Global == nil {
+		return fmt.Sprintf(
+			"%d running, %d waiting / %d free",
+			sum.Cluster.RunningJobs,
+			sum.Cluster.WaitingJobs,
+			sum.Cluster.FreeSlots,
+		)
+	}
+
+	return fmt.Sprintf(
+		"%d running, %d waiting (filtered; %d running, %d waiting in total) / %d free",
+		sum.Cluster.RunningJobs,
+		sum.Cluster.WaitingJobs,
+		sum.Global.RunningJobs,
+		sum.Global.WaitingJobs,
+		sum.Cluster.FreeSlots,
+	)
+}
+
+// clusterOutput is the JSON representation of a cluster.
+type clusterOutput struct {
+	Name string `json:"name"`
+	Summary
+}
+
+// WriteJSON writes the summaries as a JSON object.
+func WriteJSON(w io.Writer, clusters []Cluster) error {
+	out := struct {
+		Clusters []clusterOutput `json:"clusters"`
+	}{
+		Clusters: []clusterOutput{},
+	}
+
+	for _, cluster := range clusters {
+		out.Clusters = append(out.Clusters, clusterOutput{
+			Name:    cluster.Name,
+			Summary: *cluster.Top.Current(),
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// WriteCSV writes one of the summary tables as CSV with a header row.
+func WriteCSV(w io.Writer, clusters []Cluster, table string) error {
+	cw := csv.NewWriter(w)
+
+	switch table {
+	case TableCluster:
+		cw.Write([]string{
+			"cluster", "running_jobs", "waiting_jobs", "used_slots", "free_slots",
+		})
+
+		for _, cluster := range clusters {
+			sum := cluster.Top.Current().Cluster
+			cw.Write([]string{
+				cluster.Name,
+				strconv.Itoa(sum.RunningJobs),
+				strconv.Itoa(sum.WaitingJobs),
+				strconv.Itoa(sum.UsedSlots),
+				strconv.Itoa(sum.FreeSlots),
+			})
+		}
+
+	case TableNodes:
+		cw.Write([]string{
+			"cluster", "name", "active", "avail_slots", "used_slots", "owners",
+		})
+
+		for _, cluster := range clusters {
+			for _, node := range cluster.Top.Current().Nodes {
+				owners := []string{}
+				for _, owner := range node.Owners {
+					owners = append(owners, fmt.Sprintf("%s:%d", owner.Owner, owner.Occupancy))
+				}
+
+				cw.Write([]string{
+					cluster.Name,
+					node.Name,
+					strconv.FormatBool(node.Active),
+					strconv.Itoa(node.AvailSlots),
+					strconv.Itoa(node.UsedSlots),
+					strings.Join(owners, " "),
+				})
+			}
+		}
+
+	case TableJobs:
+		cw.Write([]string{
+			"cluster", "owner", "name", "state", "count", "occupancy",
+			"cpu_usage", "min_walltime", "max_walltime", "ids",
+		})
+
+		for _, cluster := range clusters {
+			for _, job := range cluster.Top.Current().Jobs {
+				cw.Write([]string{
+					cluster.Name,
+					job.Owner,
+					job.Name,
+					job.State,
+					strconv.Itoa(job.Count),
+					strconv.Itoa(job.Occupancy),
+					strconv.FormatFloat(job.CPUUsage, 'f', 3, 64),
+					strconv.Itoa(job.MinWalltime),
+					strconv.Itoa(job.MaxWalltime),
+					strings.Join(job.IDs, " "),
+				})
+			}
+		}
+
+	default:
+		return fmt.Errorf("unknown table %q", table)
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
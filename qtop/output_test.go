@@ -0,0 +1,120 @@
+package qtop
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/snsinfu/torque-qtop/torque"
+)
+
+func testClusters() []Cluster {
+	nodes := []torque.Node{
+		{Name: "node1", State: "free", SlotCount: 4},
+		{Name: "node2", State: "down", SlotCount: 4},
+	}
+
+	jobs := []torque.Job{
+		{
+			ID:        "101.server",
+			Name:      "sim-1",
+			Owner:     "alice@login",
+			State:     "R",
+			Queue:     "batch",
+			ExecSlots: []torque.Slot{{Node: "node1", Index: 0}, {Node: "node1", Index: 1}},
+			Walltime:  100,
+			CPUTime:   150,
+		},
+		{
+			ID:    "102.server",
+			Name:  "sim-2",
+			Owner: "alice@login",
+			State: "Q",
+			Queue: "batch",
+		},
+	}
+
+	sum := Summarize(nodes, jobs, Options{})
+	top := &Top{
+		sum:  &sum,
+		snap: &Snapshot{Nodes: nodes, Jobs: jobs},
+	}
+	return []Cluster{{Name: "test", Top: top}}
+}
+
+func Test_WriteJSON_UsesStableFieldNames(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := WriteJSON(&buf, testClusters()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var out struct {
+		Clusters []struct {
+			Name    string `json:"name"`
+			Cluster struct {
+				RunningJobs int `json:"running_jobs"`
+				WaitingJobs int `json:"waiting_jobs"`
+				FreeSlots   int `json:"free_slots"`
+			} `json:"cluster"`
+			Jobs []struct {
+				Owner string   `json:"owner"`
+				IDs   []string `json:"ids"`
+			} `json:"jobs"`
+		} `json:"clusters"`
+	}
+
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatalf("invalid JSON: %s", err)
+	}
+
+	if len(out.Clusters) != 1 {
+		t.Fatalf("unexpected cluster count: got %d, want 1", len(out.Clusters))
+	}
+
+	cluster := out.Clusters[0]
+
+	if cluster.Name != "test" {
+		t.Errorf("unexpected name: got %q, want %q", cluster.Name, "test")
+	}
+
+	if cluster.Cluster.RunningJobs != 1 || cluster.Cluster.WaitingJobs != 1 {
+		t.Errorf("unexpected job counts: got %+v", cluster.Cluster)
+	}
+
+	if cluster.Cluster.FreeSlots != 2 {
+		t.Errorf("unexpected free slots: got %d, want 2", cluster.Cluster.FreeSlots)
+	}
+
+	if len(cluster.Jobs) != 2 || cluster.Jobs[0].Owner != "alice@login" {
+		t.Errorf("unexpected jobs: got %+v", cluster.Jobs)
+	}
+}
+
+func Test_WriteCSV_WritesJobTable(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := WriteCSV(&buf, testClusters(), TableJobs); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := strings.Join([]string{
+		"cluster,owner,name,state,count,occupancy,cpu_usage,min_walltime,max_walltime,ids",
+		"test,alice@login,sim,Q,1,0,0.000,0,0,102.server",
+		"test,alice@login,sim,R,1,2,1.500,100,100,101.server",
+		"",
+	}, "\n")
+
+	if actual := buf.String(); actual != expected {
+		t.Errorf("unexpected output:\ngot:\n%s\nwant:\n%s", actual, expected)
+	}
+}
+
+func Test_WriteCSV_RejectsUnknownTable(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := WriteCSV(&buf, testClusters(), "queues"); err == nil {
+		t.Error("expected error")
+	}
+}
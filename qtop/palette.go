@@ -0,0 +1,29 @@
+package qtop
+
+import (
+	"hash/fnv"
+
+	"github.com/gdamore/tcell"
+)
+
+// ownerColor returns the colour of a job owner other than the current user,
+// chosen from a palette by hashing the username so that a user keeps the same
+// colour across nodes, clusters and restarts.
+func ownerColor(palette []tcell.Color, owner string) tcell.Color {
+	h := fnv.New32a()
+	h.Write([]byte(owner))
+	return palette[h.Sum32()%uint32(len(palette))]
+}
+
+// ownerStyle returns the style of slots used by a job owner. The current user,
+// me, is always shown in the owner.me style. Other owners are not coloured in
+// a theme without a palette.
+func (t Theme) ownerStyle(owner, me string) tcell.Style {
+	if owner == me {
+		return t.style(roleOwnerMe)
+	}
+	if len(t.Palette) == 0 {
+		return tcell.StyleDefault
+	}
+	return tcell.StyleDefault.Foreground(ownerColor(t.Palette, owner))
+}
@@ -0,0 +1,44 @@
+package qtop
+
+import (
+	"testing"
+
+	"github.com/gdamore/tcell"
+)
+
+func Test_ownerStyle_HighlightsCurrentUser(t *testing.T) {
+	theme, _ := LoadTheme("dark")
+
+	if fg, _, _ := theme.ownerStyle("alice", "alice").Decompose(); fg != tcell.ColorGreen {
+		t.Errorf("unexpected colour of current user: %v", fg)
+	}
+
+	for _, owner := range []string{"bob", "carol", "dave", "eve", "frank"} {
+		if fg, _, _ := theme.ownerStyle(owner, "alice").Decompose(); fg == tcell.ColorGreen {
+			t.Errorf("%s is coloured as current user", owner)
+		}
+	}
+}
+
+func Test_ownerStyle_IsStable(t *testing.T) {
+	theme, _ := LoadTheme("dark")
+
+	for _, owner := range []string{"bob", "carol", "dave"} {
+		if theme.ownerStyle(owner, "alice") != theme.ownerStyle(owner, "") {
+			t.Errorf("colour of %s depends on current user", owner)
+		}
+	}
+}
+
+func Test_ownerStyle_Monochrome(t *testing.T) {
+	theme, _ := LoadTheme("dark")
+	theme = theme.Monochrome()
+
+	if fg, _, attrs := theme.ownerStyle("alice", "alice").Decompose(); fg != tcell.ColorDefault || attrs&tcell.AttrBold == 0 {
+		t.Errorf("current user is not shown in bold without colour")
+	}
+
+	if theme.ownerStyle("bob", "alice") != tcell.StyleDefault {
+		t.Errorf("other user is styled")
+	}
+}
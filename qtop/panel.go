@@ -0,0 +1,100 @@
+package qtop
+
+import (
+	"strings"
+
+	"github.com/gdamore/tcell"
+)
+
+// A span is a piece of text drawn in a single style.
+type span struct {
+	text  string
+	style tcell.Style
+}
+
+// A panel is a scrollable overlay covering the screen, used for showing
+// details of a selected item.
+type panel struct {
+	title string
+	lines [][]span
+	view  viewport
+	theme Theme
+}
+
+// newPanel creates an empty panel with given title. Lines are styled with the
+// given theme.
+func newPanel(title string, theme Theme) *panel {
+	return &panel{title: title, theme: theme}
+}
+
+// add appends a line made of given spans to the panel.
+func (p *panel) add(spans ...span) {
+	p.lines = append(p.lines, spans)
+}
+
+// addText appends a line of text in given style to the panel.
+func (p *panel) addText(text string, style tcell.Style) {
+	p.add(span{text, style})
+}
+
+// addField appends a labelled value to the panel.
+func (p *panel) addField(label, value string) {
+	p.add(
+		span{"  " + padRight(label, 14) + " ", p.theme.style(roleDim)},
+		span{value, tcell.StyleDefault},
+	)
+}
+
+// handleKey processes a key event. It returns false if the key closes the
+// panel.
+func (p *panel) handleKey(ev *tcell.EventKey) bool {
+	switch ev.Key() {
+	case tcell.KeyEscape:
+		return false
+
+	case tcell.KeyUp:
+		p.view.scroll(-1)
+
+	case tcell.KeyDown:
+		p.view.scroll(1)
+
+	case tcell.KeyPgUp:
+		p.view.scroll(-p.view.rows())
+
+	case tcell.KeyPgDn:
+		p.view.scroll(p.view.rows())
+
+	case tcell.KeyHome:
+		p.view.scroll(-p.view.total)
+
+	case tcell.KeyEnd:
+		p.view.scroll(p.view.total)
+
+	case tcell.KeyRune:
+		switch ev.Rune() {
+		case 'q':
+			return false
+
+		case 'k':
+			p.view.scroll(-1)
+
+		case 'j':
+			p.view.scroll(1)
+
+		case 'g':
+			p.view.scroll(-p.view.total)
+
+		case 'G':
+			p.view.scroll(p.view.total)
+		}
+	}
+	return true
+}
+
+// padRight left-aligns s in n screen columns.
+func padRight(s string, n int) string {
+	if w := textWidth(s); w < n {
+		return s + strings.Repeat(" ", n-w)
+	}
+	return s
+}
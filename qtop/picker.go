@@ -0,0 +1,134 @@
+package qtop
+
+import (
+	"github.com/gdamore/tcell"
+)
+
+// A columnPicker is an overlay for choosing, reordering and resizing the
+// columns of the job list.
+type columnPicker struct {
+	items  []pickerItem
+	cursor int
+	view   viewport
+
+	// accept is called with the shown columns in order when Enter is pressed.
+	accept func(cols []jobColumn)
+}
+
+// A pickerItem is a column listed in a columnPicker.
+type pickerItem struct {
+	col   jobColumn
+	shown bool
+}
+
+// newColumnPicker creates a picker listing the shown columns in order followed
+// by the hidden ones.
+func newColumnPicker(shown []jobColumn, accept func([]jobColumn)) *columnPicker {
+	p := &columnPicker{accept: accept}
+
+	names := map[string]bool{}
+	for _, col := range shown {
+		p.items = append(p.items, pickerItem{col, true})
+		names[col.name] = true
+	}
+
+	for _, col := range jobColumns {
+		if !names[col.name] {
+			p.items = append(p.items, pickerItem{col, false})
+		}
+	}
+
+	return p
+}
+
+// columns returns the shown columns in order.
+func (p *columnPicker) columns() []jobColumn {
+	cols := []jobColumn{}
+	for _, item := range p.items {
+		if item.shown {
+			cols = append(cols, item.col)
+		}
+	}
+	return cols
+}
+
+// handleKey processes a key event. It returns false if the key closes the
+// picker.
+func (p *columnPicker) handleKey(ev *tcell.EventKey) bool {
+	switch ev.Key() {
+	case tcell.KeyEscape:
+		return false
+
+	case tcell.KeyEnter:
+		p.accept(p.columns())
+		return false
+
+	case tcell.KeyUp:
+		p.moveCursor(-1)
+
+	case tcell.KeyDown:
+		p.moveCursor(1)
+
+	case tcell.KeyRune:
+		switch ev.Rune() {
+		case 'q':
+			return false
+
+		case 'k':
+			p.moveCursor(-1)
+
+		case 'j':
+			p.moveCursor(1)
+
+		case ' ', 'x':
+			p.items[p.cursor].shown = !p.items[p.cursor].shown
+
+		case 'K':
+			p.moveItem(-1)
+
+		case 'J':
+			p.moveItem(1)
+
+		case '<', '-':
+			p.resize(-1)
+
+		case '>', '+':
+			p.resize(1)
+
+		case '=':
+			p.items[p.cursor].col, _ = findJobColumn(p.items[p.cursor].col.name)
+		}
+	}
+	return true
+}
+
+func (p *columnPicker) moveCursor(delta int) {
+	p.cursor += delta
+	if p.cursor < 0 {
+		p.cursor = 0
+	}
+	if p.cursor >= len(p.items) {
+		p.cursor = len(p.items) - 1
+	}
+}
+
+// moveItem moves the selected column by delta rows along with the cursor.
+func (p *columnPicker) moveItem(delta int) {
+	to := p.cursor + delta
+	if to < 0 || to >= len(p.items) {
+		return
+	}
+	p.items[p.cursor], p.items[to] = p.items[to], p.items[p.cursor]
+	p.cursor = to
+}
+
+// resize changes the width of the selected column by delta, fixing the width
+// of a flexible column.
+func (p *columnPicker) resize(delta int) {
+	col := &p.items[p.cursor].col
+	if col.width+delta < 1 {
+		return
+	}
+	col.width += delta
+	col.flex = 0
+}
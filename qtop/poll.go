@@ -0,0 +1,227 @@
+package qtop
+
+import (
+	"time"
+)
+
+// maxRetryDelay is the longest time to wait before querying a cluster again
+// after consecutive failures.
+const maxRetryDelay = 5 * time.Minute
+
+// errorLogSize is the number of failures kept in the error log.
+const errorLogSize = 100
+
+// intervalSteps lists the refresh intervals selectable while running.
+var intervalSteps = []time.Duration{
+	1 * time.Second,
+	2 * time.Second,
+	3 * time.Second,
+	5 * time.Second,
+	10 * time.Second,
+	15 * time.Second,
+	30 * time.Second,
+	1 * time.Minute,
+	2 * time.Minute,
+	5 * time.Minute,
+}
+
+// A poller schedules the background queries of a cluster.
+type poller struct {
+	// fetching is true while a query is in flight, and pending is true if
+	// another query is requested meanwhile.
+	fetching bool
+	pending  bool
+
+	// started is the time the last query started.
+	started time.Time
+
+	// next is the time of the next scheduled query.
+	next time.Time
+
+	// failures counts the consecutive failed queries.
+	failures int
+}
+
+// A clusterResult is the result of a background query of a cluster.
+type clusterResult struct {
+	cluster int
+	fetchResult
+}
+
+// An errorEntry is a failed query recorded in the error log.
+type errorEntry struct {
+	time    time.Time
+	cluster string
+	err     error
+}
+
+// retryDelay returns the time to wait before querying a cluster again after
+// given number of consecutive failures. The delay doubles on each failure.
+func retryDelay(interval time.Duration, failures int) time.Duration {
+	delay := interval
+	for i := 1; i < failures && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
+
+// stepInterval returns the interval in intervalSteps next to d in the
+// direction of delta, or d if there is none.
+func stepInterval(d time.Duration, delta int) time.Duration {
+	if delta > 0 {
+		for _, step := range intervalSteps {
+			if step > d {
+				return step
+			}
+		}
+	} else {
+		for i := len(intervalSteps) - 1; i >= 0; i-- {
+			if intervalSteps[i] < d {
+				return intervalSteps[i]
+			}
+		}
+	}
+	return d
+}
+
+// poll starts querying the clusters scheduled to be queried by now unless
+// paused. While replaying a recording, the playback advances every interval
+// and the clusters are queried for the new position instead, unless the
+// playback is paused.
+func (app *App) poll(now time.Time) {
+	if player := app.config.Player; player != nil {
+		if !player.Paused() && now.Sub(app.advanced) >= app.config.Interval {
+			player.Advance(app.config.Interval)
+			app.advanced = now
+			app.refreshAll()
+		}
+		return
+	}
+
+	if app.paused {
+		return
+	}
+
+	for i := range app.pollers {
+		p := &app.pollers[i]
+		if !p.fetching && !now.Before(p.next) {
+			app.refresh(i)
+		}
+	}
+}
+
+// togglePause pauses or resumes the automatic queries. Overdue queries start
+// on resuming.
+func (app *App) togglePause() {
+	app.paused = !app.paused
+
+	if app.paused {
+		app.notice = "updates paused"
+	} else {
+		app.notice = "updates resumed"
+	}
+}
+
+// setInterval changes the refresh interval. The next queries are rescheduled
+// except for the ones retrying after failures.
+func (app *App) setInterval(d time.Duration) {
+	app.config.Interval = d
+	app.notice = "interval: " + d.String()
+
+	for i := range app.pollers {
+		p := &app.pollers[i]
+		if p.failures == 0 && !p.started.IsZero() {
+			p.next = p.started.Add(d)
+		}
+	}
+}
+
+// refreshAll starts querying all the clusters in the background.
+func (app *App) refreshAll() {
+	for i := range app.clusters {
+		app.refresh(i)
+	}
+}
+
+// refresh starts querying the i-th cluster in the background. If a query is
+// in flight, another one starts when it completes.
+func (app *App) refresh(i int) {
+	p := &app.pollers[i]
+	if p.fetching {
+		p.pending = true
+		return
+	}
+	p.fetching = true
+	p.started = app.clock()
+
+	go func(top *Top) {
+		app.results <- clusterResult{i, top.fetch()}
+	}(app.clusters[i].Top)
+}
+
+// receive updates a cluster with the result of a background query. The last
+// summary is kept on failure, and the failure is logged and retried later
+// with increasing delays.
+func (app *App) receive(r clusterResult) {
+	p := &app.pollers[r.cluster]
+	cluster := app.clusters[r.cluster]
+	now := app.clock()
+
+	p.fetching = false
+
+	if err := cluster.Top.apply(r.fetchResult); err != nil {
+		p.failures++
+		p.next = now.Add(retryDelay(app.config.Interval, p.failures))
+		app.logError(errorEntry{now, cluster.Name, err})
+	} else {
+		p.failures = 0
+		p.next = p.started.Add(app.config.Interval)
+	}
+
+	if p.pending {
+		p.pending = false
+		app.refresh(r.cluster)
+	}
+}
+
+// logError appends a failure to the error log, dropping the oldest ones.
+func (app *App) logError(entry errorEntry) {
+	app.errorLog = append(app.errorLog, entry)
+	if n := len(app.errorLog) - errorLogSize; n > 0 {
+		app.errorLog = append([]errorEntry{}, app.errorLog[n:]...)
+	}
+}
+
+// fetching returns true if any of the clusters shown in the current tab is
+// being queried.
+func (app *App) fetching() bool {
+	for _, i := range app.shownClusters() {
+		if app.pollers[i].fetching {
+			return true
+		}
+	}
+	return false
+}
+
+// openErrorLog opens a panel listing the failed queries, newest first.
+func (app *App) openErrorLog() {
+	p := newPanel("Errors", app.theme)
+
+	if len(app.errorLog) == 0 {
+		p.add(span{"No errors", app.theme.style(roleDim)})
+	}
+
+	for i := len(app.errorLog) - 1; i >= 0; i-- {
+		entry := app.errorLog[i]
+		p.add(
+			span{entry.time.Format(time.Stamp) + "  ", app.theme.style(roleDim)},
+			span{entry.cluster + ": ", app.theme.style(roleHeading)},
+			span{entry.err.Error(), app.theme.style(roleNotice)},
+		)
+	}
+
+	app.panel = p
+}
@@ -0,0 +1,239 @@
+package qtop
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func Test_retryDelay_Doubles(t *testing.T) {
+	testCases := []struct {
+		failures int
+		delay    time.Duration
+	}{
+		{1, 5 * time.Second},
+		{2, 10 * time.Second},
+		{3, 20 * time.Second},
+		{6, 160 * time.Second},
+		{7, maxRetryDelay},
+		{100, maxRetryDelay},
+	}
+
+	for _, tc := range testCases {
+		if actual := retryDelay(5*time.Second, tc.failures); actual != tc.delay {
+			t.Errorf("retryDelay(5s, %d) = %s, want %s", tc.failures, actual, tc.delay)
+		}
+	}
+}
+
+func Test_App_KeepsSummaryOnFailure(t *testing.T) {
+	src := newScriptedSource()
+	clusters := []Cluster{{Name: "flaky", Top: NewSourceTop(src)}}
+	app := NewApp(clusters, nil, Config{Interval: time.Minute})
+
+	app.refresh(0)
+	src.outcomes <- nil
+	app.receive(<-app.results)
+
+	sum := clusters[0].Top.Current()
+	if sum == nil {
+		t.Fatal("summary is not made")
+	}
+
+	for i := 1; i <= 3; i++ {
+		app.refresh(0)
+		src.outcomes <- errors.New("connection refused")
+		app.receive(<-app.results)
+
+		if clusters[0].Top.Current() != sum {
+			t.Errorf("summary is changed by failure %d", i)
+		}
+
+		p := app.pollers[0]
+		if p.failures != i {
+			t.Errorf("unexpected failures: %d", p.failures)
+		}
+
+		delay := time.Until(p.next)
+		if expected := retryDelay(time.Minute, i); delay > expected || delay < expected-time.Second {
+			t.Errorf("unexpected delay after failure %d: %s", i, delay)
+		}
+	}
+
+	if len(app.errorLog) != 3 || app.errorLog[0].cluster != "flaky" {
+		t.Errorf("unexpected error log: %v", app.errorLog)
+	}
+
+	app.refresh(0)
+	src.outcomes <- nil
+	app.receive(<-app.results)
+
+	if p := app.pollers[0]; p.failures != 0 || time.Until(p.next) < 59*time.Second {
+		t.Errorf("schedule is not reset after success: %+v", p)
+	}
+	if clusters[0].Top.Err() != nil {
+		t.Errorf("error is not cleared")
+	}
+}
+
+func Test_App_RefreshesOnceAfterPendingRequest(t *testing.T) {
+	src := newScriptedSource()
+	clusters := []Cluster{{Name: "slow", Top: NewSourceTop(src)}}
+	app := NewApp(clusters, nil, Config{Interval: time.Minute})
+
+	app.refresh(0)
+	app.refresh(0)
+	app.refresh(0)
+
+	src.outcomes <- nil
+	app.receive(<-app.results)
+
+	if !app.pollers[0].fetching {
+		t.Fatal("pending refresh is not started")
+	}
+
+	src.outcomes <- nil
+	app.receive(<-app.results)
+
+	if app.pollers[0].fetching {
+		t.Error("refresh is repeated")
+	}
+}
+
+func Test_App_poll_StartsDueQueries(t *testing.T) {
+	srcs := []scriptedSource{newScriptedSource(), newScriptedSource()}
+	clusters := []Cluster{
+		{Name: "a", Top: NewSourceTop(srcs[0])},
+		{Name: "b", Top: NewSourceTop(srcs[1])},
+	}
+	app := NewApp(clusters, nil, Config{Interval: time.Minute})
+
+	now := time.Now()
+	app.pollers[1].next = now.Add(time.Second)
+	app.poll(now)
+
+	if !app.pollers[0].fetching || app.pollers[1].fetching {
+		t.Errorf("unexpected queries: %+v", app.pollers)
+	}
+
+	srcs[0].outcomes <- nil
+	app.receive(<-app.results)
+}
+
+func Test_App_logError_KeepsRecentErrors(t *testing.T) {
+	app := NewApp(nil, nil, Config{})
+
+	for i := 0; i < errorLogSize+5; i++ {
+		app.logError(errorEntry{time.Unix(int64(i), 0), "c", errors.New("failed")})
+	}
+
+	if len(app.errorLog) != errorLogSize {
+		t.Errorf("unexpected size: %d", len(app.errorLog))
+	}
+	if first := app.errorLog[0].time.Unix(); first != 5 {
+		t.Errorf("unexpected first entry: %d", first)
+	}
+}
+
+func Test_stepInterval(t *testing.T) {
+	testCases := []struct {
+		interval time.Duration
+		delta    int
+		result   time.Duration
+	}{
+		{5 * time.Second, 1, 10 * time.Second},
+		{5 * time.Second, -1, 3 * time.Second},
+		{7 * time.Second, 1, 10 * time.Second},
+		{7 * time.Second, -1, 5 * time.Second},
+		{1 * time.Second, -1, 1 * time.Second},
+		{5 * time.Minute, 1, 5 * time.Minute},
+		{time.Hour, -1, 5 * time.Minute},
+	}
+
+	for _, tc := range testCases {
+		if actual := stepInterval(tc.interval, tc.delta); actual != tc.result {
+			t.Errorf("stepInterval(%s, %d) = %s, want %s", tc.interval, tc.delta, actual, tc.result)
+		}
+	}
+}
+
+func Test_App_poll_SkipsWhilePaused(t *testing.T) {
+	src := newScriptedSource()
+	clusters := []Cluster{{Name: "a", Top: NewSourceTop(src)}}
+	app := NewApp(clusters, nil, Config{Interval: time.Minute})
+
+	app.togglePause()
+	app.poll(time.Now())
+
+	if app.pollers[0].fetching {
+		t.Fatal("queried while paused")
+	}
+
+	app.refreshAll()
+	if !app.pollers[0].fetching {
+		t.Fatal("manual refresh is ignored while paused")
+	}
+	src.outcomes <- nil
+	app.receive(<-app.results)
+
+	app.togglePause()
+	app.poll(app.pollers[0].next)
+
+	if !app.pollers[0].fetching {
+		t.Error("not queried after resuming")
+	}
+	src.outcomes <- nil
+	app.receive(<-app.results)
+}
+
+func Test_App_setInterval_Reschedules(t *testing.T) {
+	srcs := []scriptedSource{newScriptedSource(), newScriptedSource()}
+	clusters := []Cluster{
+		{Name: "ok", Top: NewSourceTop(srcs[0])},
+		{Name: "failing", Top: NewSourceTop(srcs[1])},
+	}
+	app := NewApp(clusters, nil, Config{Interval: time.Minute})
+
+	app.refreshAll()
+	srcs[0].outcomes <- nil
+	srcs[1].outcomes <- errors.New("connection refused")
+	app.receive(<-app.results)
+	app.receive(<-app.results)
+
+	retry := app.pollers[1].next
+	app.setInterval(10 * time.Second)
+
+	if app.config.Interval != 10*time.Second {
+		t.Errorf("interval is not changed: %s", app.config.Interval)
+	}
+	if p := app.pollers[0]; p.next != p.started.Add(10*time.Second) {
+		t.Errorf("query is not rescheduled: %s", p.next.Sub(p.started))
+	}
+	if app.pollers[1].next != retry {
+		t.Errorf("retry is rescheduled")
+	}
+}
+
+func Test_App_poll_SkipsWhilePlaybackPaused(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	frames := []Frame{
+		{Cluster: "alpha", Snapshot: &Snapshot{Time: start}},
+		{Cluster: "alpha", Snapshot: &Snapshot{Time: start.Add(time.Hour)}},
+	}
+
+	player, err := NewPlayer(frames)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	app := NewApp(player.Clusters(), nil, Config{Interval: time.Minute, Player: player})
+
+	player.TogglePause()
+	app.poll(time.Now())
+
+	if app.pollers[0].fetching {
+		t.Error("queried while the playback is paused")
+	}
+	if !player.Time().Equal(start) {
+		t.Errorf("playback advanced while paused: %s", player.Time())
+	}
+}
@@ -0,0 +1,70 @@
+package qtop
+
+import (
+	"github.com/gdamore/tcell"
+)
+
+// A prompt is a single-line text input shown at the bottom of the screen.
+type prompt struct {
+	label string
+	text  []rune
+	err   string
+
+	// accept is called with the text when Enter is pressed. The prompt stays
+	// open showing the error if accept fails.
+	accept func(text string) error
+
+	// change, if not nil, is called with the text whenever it is edited.
+	change func(text string)
+
+	// cancel, if not nil, is called when the prompt is closed with Esc.
+	cancel func()
+}
+
+// newPrompt creates a prompt with given label and initial text.
+func newPrompt(label, text string, accept func(string) error) *prompt {
+	return &prompt{
+		label:  label,
+		text:   []rune(text),
+		accept: accept,
+	}
+}
+
+// handleKey processes a key event. It returns false if the key closes the
+// prompt.
+func (p *prompt) handleKey(ev *tcell.EventKey) bool {
+	switch ev.Key() {
+	case tcell.KeyEscape:
+		if p.cancel != nil {
+			p.cancel()
+		}
+		return false
+
+	case tcell.KeyEnter:
+		if err := p.accept(string(p.text)); err != nil {
+			p.err = err.Error()
+			return true
+		}
+		return false
+
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if len(p.text) > 0 {
+			p.text = p.text[:len(p.text)-1]
+		}
+
+	case tcell.KeyCtrlU:
+		p.text = nil
+
+	case tcell.KeyRune:
+		p.text = append(p.text, ev.Rune())
+
+	default:
+		return true
+	}
+
+	p.err = ""
+	if p.change != nil {
+		p.change(string(p.text))
+	}
+	return true
+}
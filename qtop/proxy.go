@@ -0,0 +1,248 @@
+package qtop
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultProxySocket is the unix socket a Proxy listens on by default. It is
+// in a runtime directory writable only by root so that other users cannot
+// plant a fake proxy there.
+const DefaultProxySocket = "/run/qtop/proxy.sock"
+
+const proxyTimeout = 10 * time.Second
+
+// Proxy protocol
+//
+// request  = cluster [ TAB job ] LF
+// cluster  = name of the cluster (may be empty for the first cluster)
+// job      = ID of a job whose attributes are requested instead of a snapshot
+// response = JSON-encoded proxyResponse
+//
+// The proxy closes the connection after writing the response.
+
+type proxyResponse struct {
+	Snapshot *Snapshot         `json:"snapshot,omitempty"`
+	Attrs    map[string]string `json:"attrs,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// A Proxy polls clusters on behalf of many qtop clients and serves the latest
+// snapshots over a unix socket, so that the clients do not need to connect to
+// the PBS servers themselves.
+type Proxy struct {
+	clusters []Cluster
+	mutex    sync.RWMutex
+	snaps    map[string]*Snapshot
+	errs     map[string]error
+}
+
+// NewProxy creates a Proxy serving snapshots of given clusters.
+func NewProxy(clusters []Cluster) *Proxy {
+	return &Proxy{
+		clusters: clusters,
+		snaps:    map[string]*Snapshot{},
+		errs:     map[string]error{},
+	}
+}
+
+// Refresh updates the clusters and publishes the new snapshots to clients. It
+// keeps serving the last good snapshot of a cluster whose update failed.
+func (p *Proxy) Refresh() error {
+	err := UpdateClusters(p.clusters)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, cluster := range p.clusters {
+		p.errs[cluster.Name] = cluster.Top.Err()
+
+		if snap := cluster.Top.Snapshot(); snap != nil {
+			p.snaps[cluster.Name] = snap
+		}
+	}
+
+	return err
+}
+
+// Serve accepts client connections on ln and responds to them. It returns
+// when ln is closed.
+func (p *Proxy) Serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go p.handle(conn)
+	}
+}
+
+func (p *Proxy) handle(conn net.Conn) {
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(proxyTimeout))
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return
+	}
+	line = strings.TrimSuffix(line, "\n")
+
+	if i := strings.IndexByte(line, '\t'); i >= 0 {
+		json.NewEncoder(conn).Encode(p.lookupJob(line[:i], line[i+1:]))
+		return
+	}
+	json.NewEncoder(conn).Encode(p.lookup(line))
+}
+
+// clusterName returns the name of the cluster requested by name, which is the
+// first cluster if name is empty.
+func (p *Proxy) clusterName(name string) string {
+	if name == "" && len(p.clusters) > 0 {
+		return p.clusters[0].Name
+	}
+	return name
+}
+
+func (p *Proxy) lookup(name string) proxyResponse {
+	name = p.clusterName(name)
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	snap, ok := p.snaps[name]
+	if !ok {
+		if err := p.errs[name]; err != nil {
+			return proxyResponse{Error: err.Error()}
+		}
+		return proxyResponse{Error: "unknown cluster " + name}
+	}
+
+	return proxyResponse{Snapshot: snap}
+}
+
+// lookupJob queries the attributes of a job on the named cluster. Unlike
+// snapshots, the attributes are not cached but queried for each request.
+func (p *Proxy) lookupJob(name, id string) proxyResponse {
+	name = p.clusterName(name)
+
+	for _, cluster := range p.clusters {
+		if cluster.Name != name {
+			continue
+		}
+
+		attrs, err := cluster.Top.JobAttrs(id)
+		if err != nil {
+			return proxyResponse{Error: err.Error()}
+		}
+		return proxyResponse{Attrs: attrs}
+	}
+
+	return proxyResponse{Error: "unknown cluster " + name}
+}
+
+// ProxySource returns a Source that retrieves snapshots of the named cluster
+// from a Proxy listening on the unix socket at path. An empty name selects
+// the first cluster served by the proxy.
+func ProxySource(path, name string) Source {
+	return proxySource{path: path, name: name}
+}
+
+type proxySource struct {
+	path string
+	name string
+}
+
+func (src proxySource) Query() (*Snapshot, error) {
+	resp, err := src.request(src.name)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Snapshot == nil {
+		return nil, errors.New("proxy: no snapshot")
+	}
+
+	return resp.Snapshot, nil
+}
+
+func (src proxySource) QueryJobAttrs(id string) (map[string]string, error) {
+	resp, err := src.request(src.name + "\t" + id)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Attrs == nil {
+		return nil, errors.New("proxy: no job attributes")
+	}
+
+	return resp.Attrs, nil
+}
+
+// request sends a request line to the proxy and returns the response, or the
+// error reported by the proxy.
+func (src proxySource) request(line string) (proxyResponse, error) {
+	var resp proxyResponse
+
+	if err := CheckProxySocket(src.path); err != nil {
+		return resp, err
+	}
+
+	conn, err := net.DialTimeout("unix", src.path, proxyTimeout)
+	if err != nil {
+		return resp, err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(proxyTimeout))
+
+	if _, err := conn.Write([]byte(line + "\n")); err != nil {
+		return resp, err
+	}
+
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return resp, err
+	}
+
+	if resp.Error != "" {
+		return resp, errors.New("proxy: " + resp.Error)
+	}
+
+	return resp, nil
+}
+
+func (src proxySource) Close() error {
+	return nil
+}
+
+// CheckProxySocket returns an error if path is not a unix socket owned by root
+// or by the current user. Any user may create a socket in a shared directory,
+// so a socket owned by someone else may serve fake cluster state.
+func CheckProxySocket(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("proxy: %s is not a socket", path)
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fmt.Errorf("proxy: cannot tell the owner of %s", path)
+	}
+	if stat.Uid != 0 && int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("proxy: %s is owned by untrusted uid %d", path, stat.Uid)
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package qtop
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/snsinfu/torque-qtop/torque"
+)
+
+type staticSource struct {
+	snap *Snapshot
+}
+
+func (src staticSource) Query() (*Snapshot, error) {
+	return src.snap, nil
+}
+
+func (src staticSource) Close() error {
+	return nil
+}
+
+func Test_Proxy_ServesSnapshot(t *testing.T) {
+	const sock = "test-qtop-Proxy.socket"
+
+	snap := &Snapshot{
+		Nodes: []torque.Node{{Name: "node1", State: "free", SlotCount: 4}},
+		Jobs:  []torque.Job{{ID: "101.server", Name: "foo", Owner: "alice@login", State: "Q"}},
+	}
+
+	proxy := NewProxy([]Cluster{
+		{Name: "alpha", Top: NewSourceTop(staticSource{snap})},
+	})
+
+	if err := proxy.Refresh(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("Listen failed: %s", err)
+	}
+	defer os.Remove(sock)
+	defer ln.Close()
+
+	go proxy.Serve(ln)
+
+	for _, name := range []string{"alpha", ""} {
+		actual, err := ProxySource(sock, name).Query()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if !reflect.DeepEqual(actual.Jobs, snap.Jobs) || !reflect.DeepEqual(actual.Nodes, snap.Nodes) {
+			t.Errorf("unexpected snapshot: got %v, want %v", actual, snap)
+		}
+	}
+
+	if _, err := ProxySource(sock, "beta").Query(); err == nil {
+		t.Error("expected error for unknown cluster")
+	}
+}
+
+func Test_ProxySource_QueriesJobAttrs(t *testing.T) {
+	const sock = "test-qtop-ProxySource.socket"
+
+	src := detailSource{
+		staticSource: staticSource{&Snapshot{}},
+		attrs:        make(chan map[string]string, 1),
+	}
+	src.attrs <- map[string]string{"Job_Name": "foo", "queue": "batch"}
+
+	proxy := NewProxy([]Cluster{
+		{Name: "alpha", Top: NewSourceTop(src)},
+		{Name: "beta", Top: NewSourceTop(staticSource{&Snapshot{}})},
+	})
+
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("Listen failed: %s", err)
+	}
+	defer os.Remove(sock)
+	defer ln.Close()
+
+	go proxy.Serve(ln)
+
+	// The TUI queries the attributes through the Top of the cluster.
+	top := NewSourceTop(ProxySource(sock, "alpha"))
+
+	attrs, err := top.JobAttrs("101.server")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if attrs["Job_Name"] != "foo" || attrs["queue"] != "batch" {
+		t.Errorf("unexpected attributes: %v", attrs)
+	}
+
+	if _, err := NewSourceTop(ProxySource(sock, "beta")).JobAttrs("101.server"); err == nil {
+		t.Error("expected error for cluster without job attributes")
+	}
+}
+
+func Test_CheckProxySocket(t *testing.T) {
+	const sock = "test-qtop-CheckProxySocket.socket"
+	const file = "test-qtop-CheckProxySocket.txt"
+
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("Listen failed: %s", err)
+	}
+	defer os.Remove(sock)
+	defer ln.Close()
+
+	if err := CheckProxySocket(sock); err != nil {
+		t.Errorf("own socket is rejected: %s", err)
+	}
+
+	if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file)
+
+	if err := CheckProxySocket(file); err == nil {
+		t.Errorf("regular file is accepted")
+	}
+
+	if err := CheckProxySocket("test-qtop-CheckProxySocket.missing"); err == nil {
+		t.Errorf("missing socket is accepted")
+	}
+
+	// Only root can give the socket to another user.
+	if os.Getuid() != 0 {
+		return
+	}
+	if err := os.Lchown(sock, 12345, 12345); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckProxySocket(sock); err == nil {
+		t.Errorf("socket of another user is accepted")
+	}
+	if _, err := ProxySource(sock, "").Query(); err == nil {
+		t.Errorf("socket of another user is queried")
+	}
+}
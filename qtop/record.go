@@ -0,0 +1,238 @@
+package qtop
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Recording format
+//
+// A recording is a sequence of gzip members, each containing a single line of
+// JSON. The first line is a recordHeader and the subsequent lines are Frames.
+// Appending a frame to a recording is done by appending a gzip member, so a
+// recording interrupted at any point is still readable.
+
+const (
+	recordFormat  = "qtop-record"
+	recordVersion = 1
+)
+
+type recordHeader struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+}
+
+// A Frame is a snapshot of a cluster stored in a recording.
+type Frame struct {
+	Cluster  string    `json:"cluster"`
+	Snapshot *Snapshot `json:"snapshot"`
+}
+
+// A Recorder appends frames to a recording file.
+type Recorder struct {
+	file  *os.File
+	mutex sync.Mutex
+}
+
+// OpenRecorder opens a recording file for appending frames. The file is
+// created if it does not exist.
+func OpenRecorder(filename string) (*Recorder, error) {
+	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	rec := &Recorder{file: file}
+
+	if info.Size() == 0 {
+		err = rec.write(recordHeader{Format: recordFormat, Version: recordVersion})
+	} else {
+		_, err = readRecordHeader(file)
+	}
+
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+// Record appends a snapshot of the named cluster to the recording. It is safe
+// to call Record concurrently.
+func (rec *Recorder) Record(cluster string, snap *Snapshot) error {
+	return rec.write(Frame{Cluster: cluster, Snapshot: snap})
+}
+
+func (rec *Recorder) write(v interface{}) error {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+
+	// Write a whole member at once so that the file is never left with a
+	// partial member.
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+
+	if err := json.NewEncoder(zw).Encode(v); err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	_, err := rec.file.Write(buf.Bytes())
+	return err
+}
+
+// Close closes the recording file.
+func (rec *Recorder) Close() error {
+	return rec.file.Close()
+}
+
+// ReadRecording reads all the frames in a recording file ordered by time.
+func ReadRecording(filename string) ([]Frame, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	zr, err := gzip.NewReader(bufio.NewReader(file))
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(zr)
+
+	var header recordHeader
+	if err := dec.Decode(&header); err != nil {
+		return nil, err
+	}
+
+	if err := header.validate(); err != nil {
+		return nil, err
+	}
+
+	frames := []Frame{}
+
+	for {
+		var frame Frame
+
+		err := dec.Decode(&frame)
+		if err == io.EOF {
+			break
+		}
+
+		// Tolerate truncated tail, which occurs if the recorder was killed.
+		if err == io.ErrUnexpectedEOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if frame.Snapshot == nil {
+			return nil, errors.New("recording contains a frame without snapshot")
+		}
+
+		frames = append(frames, frame)
+	}
+
+	sort.SliceStable(frames, func(i, j int) bool {
+		return frames[i].Snapshot.Time.Before(frames[j].Snapshot.Time)
+	})
+
+	return frames, nil
+}
+
+func readRecordHeader(r io.Reader) (recordHeader, error) {
+	var header recordHeader
+
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return header, err
+	}
+
+	if err := json.NewDecoder(zr).Decode(&header); err != nil {
+		return header, err
+	}
+
+	return header, header.validate()
+}
+
+func (header recordHeader) validate() error {
+	if header.Format != recordFormat {
+		return errors.New("not a qtop recording")
+	}
+
+	if header.Version != recordVersion {
+		return fmt.Errorf("unsupported recording version %d", header.Version)
+	}
+
+	return nil
+}
+
+// RecordClusters returns clusters that work like the given ones but also
+// record every retrieved snapshot with rec.
+func RecordClusters(clusters []Cluster, rec *Recorder) []Cluster {
+	recorded := []Cluster{}
+
+	for _, cluster := range clusters {
+		recorded = append(recorded, Cluster{
+			Name: cluster.Name,
+			Top: NewSourceTop(recordingSource{
+				src:  cluster.Top.src,
+				rec:  rec,
+				name: cluster.Name,
+			}),
+		})
+	}
+
+	return recorded
+}
+
+type recordingSource struct {
+	src  Source
+	rec  *Recorder
+	name string
+}
+
+func (src recordingSource) Query() (*Snapshot, error) {
+	snap, err := src.src.Query()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := src.rec.Record(src.name, snap); err != nil {
+		return nil, fmt.Errorf("record: %s", err)
+	}
+
+	return snap, nil
+}
+
+func (src recordingSource) Close() error {
+	return src.src.Close()
+}
+
+func (src recordingSource) QueryJobAttrs(id string) (map[string]string, error) {
+	if detailer, ok := src.src.(JobDetailer); ok {
+		return detailer.QueryJobAttrs(id)
+	}
+	return nil, errNoJobDetail
+}
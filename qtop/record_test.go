@@ -0,0 +1,118 @@
+package qtop
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/snsinfu/torque-qtop/torque"
+)
+
+func Test_Recorder_AppendsReadableFrames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qtop")
+	if err != nil {
+		t.Fatalf("TempDir failed: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "test.qrec")
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Record in two sessions to test appending.
+	for i := 0; i < 2; i++ {
+		rec, err := OpenRecorder(filename)
+		if err != nil {
+			t.Fatalf("OpenRecorder failed: %s", err)
+		}
+
+		snap := &Snapshot{
+			Time: start.Add(time.Duration(i) * time.Minute),
+			Jobs: []torque.Job{{ID: "101.server", State: "R"}},
+		}
+
+		if err := rec.Record("alpha", snap); err != nil {
+			t.Fatalf("Record failed: %s", err)
+		}
+		rec.Close()
+	}
+
+	frames, err := ReadRecording(filename)
+	if err != nil {
+		t.Fatalf("ReadRecording failed: %s", err)
+	}
+
+	if len(frames) != 2 {
+		t.Fatalf("unexpected frame count: got %d, want 2", len(frames))
+	}
+
+	for i, frame := range frames {
+		if frame.Cluster != "alpha" {
+			t.Errorf("unexpected cluster: got %q, want %q", frame.Cluster, "alpha")
+		}
+
+		expected := start.Add(time.Duration(i) * time.Minute)
+		if !frame.Snapshot.Time.Equal(expected) {
+			t.Errorf("unexpected time: got %s, want %s", frame.Snapshot.Time, expected)
+		}
+	}
+}
+
+func Test_OpenRecorder_RejectsNonRecording(t *testing.T) {
+	file, err := ioutil.TempFile("", "qtop")
+	if err != nil {
+		t.Fatalf("TempFile failed: %s", err)
+	}
+	defer os.Remove(file.Name())
+
+	file.WriteString("not a recording")
+	file.Close()
+
+	if _, err := OpenRecorder(file.Name()); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func Test_Player_StepsThroughRefreshes(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	frame := func(cluster string, sec int) Frame {
+		snap := &Snapshot{Time: start.Add(time.Duration(sec) * time.Second)}
+		return Frame{Cluster: cluster, Snapshot: snap}
+	}
+
+	// Two refreshes of two clusters.
+	frames := []Frame{
+		frame("alpha", 0), frame("beta", 1),
+		frame("alpha", 10), frame("beta", 11),
+	}
+
+	player, err := NewPlayer(frames)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if snap := player.snapshot("beta"); snap != frames[1].Snapshot {
+		t.Errorf("unexpected first snapshot: got %v", snap.Time)
+	}
+
+	player.Step(1)
+
+	if snap := player.snapshot("alpha"); snap != frames[2].Snapshot {
+		t.Errorf("unexpected snapshot after step: got %v", snap.Time)
+	}
+
+	player.Step(5)
+
+	if snap := player.snapshot("beta"); snap != frames[3].Snapshot {
+		t.Errorf("unexpected snapshot after overstep: got %v", snap.Time)
+	}
+
+	player.Step(-1)
+	player.Advance(time.Minute)
+
+	if !player.Time().Equal(frames[3].Snapshot.Time) {
+		t.Errorf("playback went past the end: %s", player.Time())
+	}
+}
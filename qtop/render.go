@@ -0,0 +1,641 @@
+package qtop
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell"
+	"github.com/mattn/go-runewidth"
+)
+
+const (
+	xMargin = 2
+	yMargin = 1
+)
+
+// nodeTrendWidth is the width of the sparklines of the nodes.
+const nodeTrendWidth = 8
+
+// staleIntervals is the number of refresh intervals after which the shown data
+// is marked as stale.
+const staleIntervals = 2
+
+// A renderer draws screen models.
+type renderer interface {
+	render(m *screenModel)
+}
+
+// A screenRenderer draws screen models on a terminal screen in the colours of
+// a theme.
+type screenRenderer struct {
+	scr   tcell.Screen
+	theme Theme
+}
+
+// redraw lays out the screen for the current state and draws it anew.
+func (app *App) redraw() {
+	app.layout()
+	app.renderer.render(app.model())
+}
+
+// render draws m on a cleared screen.
+func (r *screenRenderer) render(m *screenModel) {
+	r.scr.Clear()
+	r.scr.HideCursor()
+
+	if m.overlay != nil {
+		r.drawOverlay(m.overlay)
+		r.scr.Show()
+		return
+	}
+
+	_, h := r.scr.Size()
+	r.drawBottom(h-1, &m.bottom)
+
+	y := 0
+	if len(m.tabs) > 0 {
+		y = r.drawTabs(y, m.tabs, m.tab) + yMargin
+	}
+
+	switch {
+	case m.mine != nil:
+		r.drawStatus(y, m, m.mine.totals, tcell.StyleDefault)
+		r.drawJobList(&m.mine.jobs, m.me)
+
+	case m.cluster != nil:
+		r.drawCluster(y, m, m.cluster)
+
+	default:
+		r.drawStatus(y, m, m.loading, tcell.StyleDefault)
+	}
+
+	r.scr.Show()
+}
+
+// drawOverlay draws o over the whole screen.
+func (r *screenRenderer) drawOverlay(o *overlayModel) {
+	scr := r.scr
+	w, h := scr.Size()
+
+	styleTitle := r.theme.style(roleHeader)
+
+	x := printStr(scr, 0, 0, "  "+o.title, styleTitle)
+	if x < w {
+		printStr(scr, x, 0, strings.Repeat(" ", w-x), styleTitle)
+	}
+
+	view := &o.view
+	for i := 0; i < view.rows() && view.offset+i < len(o.lines); i++ {
+		x := xMargin
+		for _, sp := range o.lines[view.offset+i] {
+			x += printStr(scr, x, view.top+i, sp.text, sp.style)
+		}
+	}
+	if o.cursor {
+		r.drawCursor(view)
+	}
+	r.drawMore(view)
+
+	printStr(scr, xMargin, h-1, o.hint, r.theme.style(roleDim))
+}
+
+// drawBottom draws the bottom row in screen row y.
+func (r *screenRenderer) drawBottom(y int, b *bottomModel) {
+	switch {
+	case b.prompt != nil:
+		r.drawPrompt(y, b.prompt)
+
+	case b.notice != "":
+		printStr(r.scr, xMargin, y, b.notice, r.theme.style(roleNotice))
+
+	case b.errors != "":
+		r.drawErrorStatus(y, b.errors)
+
+	default:
+		r.drawHints(y, b.hints)
+	}
+}
+
+// drawPrompt draws a prompt in screen row y with the terminal cursor at the
+// end of the text.
+func (r *screenRenderer) drawPrompt(y int, p *promptModel) {
+	scr := r.scr
+
+	x := xMargin
+	x += printStr(scr, x, y, p.label+": ", r.theme.style(rolePrompt))
+	x += printStr(scr, x, y, p.text, tcell.StyleDefault)
+	scr.ShowCursor(x, y)
+	x += 1
+
+	if p.err != "" {
+		printStr(scr, x+1, y, p.err, r.theme.style(roleNotice))
+	}
+}
+
+// drawHints draws the keys of the common actions in row y as many as fit.
+func (r *screenRenderer) drawHints(y int, hints []keyHint) {
+	scr := r.scr
+	w, _ := scr.Size()
+
+	styleKey := r.theme.style(roleHeading)
+	styleLabel := r.theme.style(roleDim)
+
+	x := xMargin
+	for _, hint := range hints {
+		if x+textWidth(hint.key)+1+textWidth(hint.label) > w-xMargin {
+			break
+		}
+		x += printStr(scr, x, y, hint.key, styleKey)
+		x += 1
+		x += printStr(scr, x, y, hint.label, styleLabel)
+		x += 2
+	}
+}
+
+// drawErrorStatus draws a status bar describing failed queries in row y.
+func (r *screenRenderer) drawErrorStatus(y int, status string) {
+	scr := r.scr
+	w, _ := scr.Size()
+	style := r.theme.style(roleError)
+
+	printStr(scr, 0, y, strings.Repeat(" ", w), style)
+	printStr(scr, xMargin, y, truncate(status, w-2*xMargin), style)
+}
+
+func (r *screenRenderer) drawTabs(y int, names []string, active int) int {
+	scr := r.scr
+	w, _ := scr.Size()
+
+	style := r.theme.style(roleTab)
+	styleActive := r.theme.style(roleTabActive)
+
+	x := xMargin
+	for i, name := range names {
+		tabStyle := style
+		if i == active {
+			tabStyle = styleActive
+		}
+		x += printStr(scr, x, y, " "+name+" ", tabStyle)
+		x += 1
+	}
+
+	if x < w {
+		printStr(scr, x, y, strings.Repeat(" ", w-x), tcell.StyleDefault)
+	}
+
+	return y + 1
+}
+
+// drawClock draws the clock and the status of the data at the right end of
+// row y. It returns the leftmost column drawn.
+func (r *screenRenderer) drawClock(y int, m *screenModel) int {
+	scr := r.scr
+	w, _ := scr.Size()
+
+	x := w - textWidth(m.clock) - xMargin
+	printStr(scr, x, y, m.clock, tcell.StyleDefault)
+
+	if m.status != "" {
+		x -= textWidth(m.status) + 2
+		printStr(scr, x, y, m.status, r.theme.style(m.statusRole))
+	}
+	return x
+}
+
+// drawStatus draws text at the left end of row y followed by the clock. The
+// text is truncated so as not to overlap the clock.
+func (r *screenRenderer) drawStatus(y int, m *screenModel, text string, style tcell.Style) {
+	x := r.drawClock(y, m)
+	printStr(r.scr, xMargin, y, truncate(text, x-2-xMargin), style)
+}
+
+// drawCluster draws the tab of a cluster from row y.
+func (r *screenRenderer) drawCluster(y int, m *screenModel, c *clusterModel) {
+	r.drawStatus(y, m, c.totals, tcell.StyleDefault)
+	y++
+
+	if c.filter != "" {
+		printStr(r.scr, xMargin, y, "filter: "+c.filter, r.theme.style(roleNotice))
+		y++
+	}
+
+	if c.trends != nil {
+		r.drawTrends(y, c.trends)
+		y++
+	}
+
+	if c.legendShown {
+		r.drawLegend(y, c.legend, m.me)
+	}
+
+	r.drawNodes(&c.nodes, m.me)
+	r.drawJobList(&c.jobs, m.me)
+}
+
+// drawTrends draws the sparklines of the used slots and the waiting jobs of a
+// cluster in row y.
+func (r *screenRenderer) drawTrends(y int, t *trendsModel) {
+	scr := r.scr
+
+	styleLabel := r.theme.style(roleDim)
+	styleTrend := r.theme.style(roleTrend)
+
+	x := xMargin
+	x += printStr(scr, x, y, "slots ", styleLabel)
+	x += printStr(scr, x, y, padRight(sparkline(t.usage, 1, t.width), t.width), styleTrend)
+	x += printStr(scr, x, y, t.slots, tcell.StyleDefault)
+	x += printStr(scr, x, y, "  waiting ", styleLabel)
+	x += printStr(scr, x, y, padRight(sparkline(t.waiting, t.waitingMax, t.width), t.width), styleTrend)
+	printStr(scr, x, y, t.waitingCount, tcell.StyleDefault)
+}
+
+// drawLegend draws the colours of the owners in row y as many as fit.
+func (r *screenRenderer) drawLegend(y int, legend []legendItem, me string) {
+	scr := r.scr
+	w, _ := scr.Size()
+
+	x := xMargin
+	for _, item := range legend {
+		text := fmt.Sprintf("%s %d", item.owner, item.slots)
+		if x+2+textWidth(text) > w-xMargin {
+			break
+		}
+
+		x += printStr(scr, x, y, "||", r.theme.ownerStyle(item.owner, me))
+		x += 1
+		x += printStr(scr, x, y, text, tcell.StyleDefault)
+		x += 2
+	}
+}
+
+// drawNodes draws the visible part of the node list.
+func (r *screenRenderer) drawNodes(l *nodeListModel, me string) {
+	scr := r.scr
+
+	// Node name and meter. Used slots are coloured by owner.
+
+	y := l.view.top
+	xRight := 0
+
+	for i, node := range l.nodes {
+		name := padRight(node.Name, l.nameWidth)
+		util := fmt.Sprintf("[%2d/%2d]", node.UsedSlots, node.AvailSlots)
+		style := r.theme.style(roleNode)
+
+		if !node.Active {
+			util = "[--/--]"
+			style = r.theme.style(roleNodeDown)
+		}
+
+		x := xMargin
+		x += printStr(scr, x, y, name, style)
+		x += 1
+		x += printStr(scr, x, y, util, r.theme.style(roleDim))
+		x += 1
+
+		if l.trendWidth > 0 {
+			spark := sparkline(l.trends[i], 1, l.trendWidth)
+			x += printStr(scr, x, y, padRight(spark, l.trendWidth), r.theme.style(roleTrend))
+			x += 1
+		}
+
+		used := 0
+		for _, ownerSum := range node.Owners {
+			style := r.theme.ownerStyle(abbrevUsername(ownerSum.Owner), me)
+			x += printStr(scr, x, y, strings.Repeat("|", ownerSum.Occupancy), style)
+			used += ownerSum.Occupancy
+		}
+
+		if rest := node.UsedSlots - used; rest > 0 {
+			x += printStr(scr, x, y, strings.Repeat("|", rest), tcell.StyleDefault)
+		}
+
+		if free := node.AvailSlots - node.UsedSlots; free > 0 {
+			x += printStr(scr, x, y, strings.Repeat(".", free), r.theme.style(roleDim))
+		}
+
+		if x > xRight {
+			xRight = x
+		}
+		y++
+	}
+
+	// Node owners
+
+	y = l.view.top
+
+	for _, node := range l.nodes {
+		x := xRight + xMargin
+
+		for _, ownerSum := range node.Owners {
+			user := abbrevUsername(ownerSum.Owner)
+			info := fmt.Sprintf("%d:%s", ownerSum.Occupancy, user)
+
+			x += printStr(scr, x, y, info, r.theme.ownerStyle(user, me))
+			x += 1
+		}
+
+		y++
+	}
+
+	r.drawList(&l.listModel)
+}
+
+// drawJobList draws the header and the visible part of a job list.
+func (r *screenRenderer) drawJobList(l *jobListModel, me string) {
+	r.drawJobHeader(l)
+
+	for i, row := range l.rows {
+		y := l.view.top + i
+		if row.job != nil {
+			r.drawJob(y, l.columns, *row.job)
+			continue
+		}
+		printStr(r.scr, xMargin, y, row.heading, r.theme.style(roleHeading))
+	}
+
+	r.drawList(&l.listModel)
+}
+
+// drawList draws the focus bar, the search hits, the cursor and the marker of
+// hidden rows over a list.
+func (r *screenRenderer) drawList(l *listModel) {
+	view := &l.view
+
+	if l.focused {
+		style := r.theme.style(roleFocus)
+		for y := view.top; y < view.top+view.height; y++ {
+			r.scr.SetContent(0, y, '▌', nil, style)
+		}
+	}
+
+	for i := 0; i < view.rows() && view.offset+i < view.total; i++ {
+		if l.hits[view.offset+i] {
+			r.highlightRow(view.top+i, roleMatch)
+		}
+	}
+
+	if l.cursor {
+		r.drawCursor(view)
+	}
+	r.drawMore(view)
+}
+
+// drawCursor highlights the selected row of a viewport.
+func (r *screenRenderer) drawCursor(view *viewport) {
+	if view.total == 0 || view.cursor < view.offset || view.cursor >= view.offset+view.rows() {
+		return
+	}
+	r.highlightRow(view.top+view.cursor-view.offset, roleCursor)
+}
+
+// highlightRow lays the style of a role over a screen row within the margins.
+func (r *screenRenderer) highlightRow(y int, role string) {
+	scr := r.scr
+	w, _ := scr.Size()
+
+	for x := xMargin; x < w-xMargin; {
+		c, comb, style, width := scr.GetContent(x, y)
+		scr.SetContent(x, y, c, comb, r.theme.Styles.highlight(style, role))
+		x += width
+	}
+}
+
+// drawMore draws a marker showing the numbers of hidden rows in the last row
+// of a clipped viewport.
+func (r *screenRenderer) drawMore(view *viewport) {
+	if !view.clipped() || view.height == 0 {
+		return
+	}
+
+	above, below := view.hidden()
+
+	counts := []string{}
+	if above > 0 {
+		counts = append(counts, fmt.Sprintf("↑%d", above))
+	}
+	if below > 0 {
+		counts = append(counts, fmt.Sprintf("↓%d", below))
+	}
+	marker := strings.Join(counts, " ") + " more…"
+
+	y := view.top + view.height - 1
+	printStr(r.scr, xMargin, y, marker, r.theme.style(roleDim))
+}
+
+// drawJobHeader draws the header of a job list with an arrow marking the sort
+// column.
+func (r *screenRenderer) drawJobHeader(l *jobListModel) {
+	style := r.theme.style(roleHeader)
+	y := l.header
+
+	scr := r.scr
+	w, _ := scr.Size()
+
+	arrow := "↑"
+	if l.order.Descending {
+		arrow = "↓"
+	}
+
+	printStr(scr, 0, y, strings.Repeat(" ", w), style)
+
+	// Arrows take the separator space next to narrow columns.
+	widths := layoutColumns(l.columns, w)
+	x := xMargin
+	shown := false
+	for i, col := range l.columns {
+		width := widths[i]
+
+		label := col.label
+		if col.key == l.order.Key {
+			shown = true
+			if col.right {
+				label = arrow + label
+			} else {
+				label += arrow
+			}
+		}
+
+		if col.right {
+			printStr(scr, x+width-textWidth(label), y, label, style)
+		} else {
+			printStr(scr, x, y, label, style)
+		}
+		x += width + 1
+	}
+
+	if !shown {
+		printStr(scr, x+1, y, "(by "+l.order.Key.String()+arrow+")", style)
+	}
+}
+
+// drawJob draws a job row in screen row y.
+func (r *screenRenderer) drawJob(y int, columns []jobColumn, row jobRow) {
+	scr := r.scr
+	w, _ := scr.Size()
+	widths := layoutColumns(columns, w)
+
+	x := xMargin
+	for i, col := range columns {
+		text := col.value(row)
+		if col.tail {
+			text = truncateLeft(text, widths[i])
+		} else {
+			text = truncate(text, widths[i])
+		}
+		if col.right {
+			text = padLeft(text, widths[i])
+		}
+
+		style := tcell.StyleDefault
+		if col.role != nil {
+			style = r.theme.style(col.role(row))
+		}
+
+		printStr(scr, x, y, text, style)
+		x += widths[i] + 1
+	}
+}
+
+// textWidth returns the number of screen columns taken by s.
+func textWidth(s string) int {
+	return runewidth.StringWidth(s)
+}
+
+// truncate cuts s to fit in width screen columns, marking the cut with an
+// ellipsis.
+func truncate(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	return runewidth.Truncate(s, width, "…")
+}
+
+// truncateLeft removes runes from the start of s so that it fits width
+// screen columns.
+func truncateLeft(s string, width int) string {
+	for textWidth(s) > width {
+		_, n := utf8.DecodeRuneInString(s)
+		s = s[n:]
+	}
+	return s
+}
+
+// padLeft right-aligns s in n screen columns.
+func padLeft(s string, n int) string {
+	if w := textWidth(s); w < n {
+		return strings.Repeat(" ", n-w) + s
+	}
+	return s
+}
+
+// printStr draws s at column x of row y and returns the number of screen
+// columns taken. Wide characters take two columns and combining characters
+// are drawn in the cell of the preceding character.
+func printStr(scr tcell.Screen, x, y int, s string, style tcell.Style) int {
+	n := 0
+
+	var mainc rune
+	var combc []rune
+	width := 0
+
+	flush := func() {
+		if width > 0 {
+			scr.SetContent(x+n, y, mainc, combc, style)
+			n += width
+		}
+	}
+
+	for _, c := range s {
+		w := runewidth.RuneWidth(c)
+		if w == 0 {
+			if width > 0 {
+				combc = append(combc, c)
+			}
+			continue
+		}
+		flush()
+		mainc, combc, width = c, nil, w
+	}
+	flush()
+
+	return n
+}
+
+// formatDuration formats a duration in a short form like "12s" or "3m".
+func formatDuration(d time.Duration) string {
+	switch {
+	case d < 0:
+		return "0s"
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d/time.Second))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d/time.Minute))
+	}
+	return fmt.Sprintf("%dh", int(d/time.Hour))
+}
+
+func formatClock(n int) string {
+	sec := n
+	min := sec / 60
+	hour := min / 60
+
+	return fmt.Sprintf("%3d:%02d:%02d", hour, min%60, sec%60)
+}
+
+func abbrevUsername(s string) string {
+	if n := strings.Index(s, "@"); n != -1 {
+		return s[:n]
+	}
+	return s
+}
+
+func compressIDs(ids []string) string {
+	prefix := commonPrefix(ids)
+	if strings.HasSuffix(prefix, "[") {
+		return prefix + "]"
+	}
+
+	shortIDs := []string{}
+	for _, id := range ids {
+		shortIDs = append(shortIDs, abbrevID(id))
+	}
+	return strings.Join(shortIDs, " ")
+}
+
+func abbrevID(s string) string {
+	if n := strings.Index(s, "."); n != -1 {
+		return s[:n]
+	}
+	return s
+}
+
+func commonPrefix(arr []string) string {
+	if len(arr) == 0 {
+		return ""
+	}
+
+	prefix := arr[0]
+	for _, s := range arr[1:] {
+		prefix = prefix[:mismatch(prefix, s)]
+	}
+	return prefix
+}
+
+func mismatch(s1, s2 string) int {
+	var n int
+	if len(s1) < len(s2) {
+		n = len(s1)
+	} else {
+		n = len(s2)
+	}
+
+	for i := 0; i < n; i++ {
+		if s1[i] != s2[i] {
+			return i
+		}
+	}
+	return n
+}
@@ -0,0 +1,322 @@
+package qtop
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell"
+	"github.com/snsinfu/torque-qtop/torque"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden screens in testdata")
+
+// goldenClock is the time at which the golden screens are drawn.
+var goldenClock = time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// goldenSnapshot returns a snapshot of a small cluster taken at time t.
+func goldenSnapshot(t time.Time) *Snapshot {
+	slots := func(node string, from, to int) []torque.Slot {
+		s := []torque.Slot{}
+		for i := from; i < to; i++ {
+			s = append(s, torque.Slot{Node: node, Index: i})
+		}
+		return s
+	}
+
+	nodes := []torque.Node{
+		{Name: "node01", State: "job-exclusive", SlotCount: 8},
+		{Name: "node02", State: "free", SlotCount: 8},
+		{Name: "node03", State: "free", SlotCount: 8},
+		{Name: "node04", State: "down", SlotCount: 8},
+		{Name: "gpu01", State: "free", SlotCount: 16, Properties: []string{"gpu"}},
+	}
+
+	jobs := []torque.Job{
+		{
+			ID: "1001.server", Name: "relax", Owner: "alice@login", State: "R", Queue: "batch",
+			ExecSlots: slots("node01", 0, 8), Walltime: 3600, CPUTime: 27000,
+			RequestedWalltime: 86400, Memory: 2 << 30, QueueTime: t.Add(-2 * time.Hour).Unix(),
+		},
+		{
+			ID: "1002.server", Name: "sim", Owner: "bob@login", State: "R", Queue: "long",
+			ExecSlots: slots("node02", 0, 4), Walltime: 600, CPUTime: 1800,
+			Memory: 300 << 20, QueueTime: t.Add(-time.Hour).Unix(),
+		},
+		{
+			ID: "1003.server", Name: "sim", Owner: "bob@login", State: "R", Queue: "long",
+			ExecSlots: slots("gpu01", 0, 4), Walltime: 660, CPUTime: 2400,
+			Memory: 310 << 20, QueueTime: t.Add(-time.Hour).Unix(),
+		},
+		{
+			ID: "1004.server", Name: "解析ジョブ", Owner: "carol@login", State: "R", Queue: "batch",
+			ExecSlots: slots("node03", 0, 2), Walltime: 120, CPUTime: 200,
+			QueueTime: t.Add(-10 * time.Minute).Unix(),
+		},
+		{
+			ID: "1005.server", Name: "a-job-with-a-rather-long-name", Owner: "dave@login", State: "Q",
+			Queue: "batch", QueueTime: t.Add(-90 * time.Minute).Unix(),
+		},
+		{
+			ID: "1006.server", Name: "sweep", Owner: "dave@login", State: "Q", Queue: "long",
+			QueueTime: t.Add(-5 * time.Minute).Unix(),
+		},
+		{
+			ID: "1007.server", Name: "done", Owner: "alice@login", State: "C", Queue: "batch",
+			ExitStatus: "0", QueueTime: t.Add(-3 * time.Hour).Unix(),
+		},
+	}
+
+	return &Snapshot{Time: t, Nodes: nodes, Jobs: jobs}
+}
+
+// newGoldenApp creates an App showing clusters on a w-by-h screen with the
+// clock fixed to goldenClock.
+func newGoldenApp(t *testing.T, w, h int, clusters []Cluster) *App {
+	app := NewApp(clusters, newTestScreen(t, w, h), Config{Interval: time.Minute})
+	app.clock = func() time.Time { return goldenClock }
+	return app
+}
+
+// queryAll queries all the clusters of app once.
+func queryAll(app *App) {
+	app.refreshAll()
+	for range app.clusters {
+		app.receive(<-app.results)
+	}
+}
+
+// goldenCluster returns a cluster serving the golden snapshot taken 3 seconds
+// before goldenClock.
+func goldenCluster(name string) Cluster {
+	snap := goldenSnapshot(goldenClock.Add(-3 * time.Second))
+	return Cluster{Name: name, Top: NewSourceTop(staticSource{snap})}
+}
+
+// screenText returns the text shown on the screen of app.
+func screenText(app *App) string {
+	_, h := app.scr.Size()
+
+	rows := []string{}
+	for y := 0; y < h; y++ {
+		rows = append(rows, screenRow(app.scr.(tcell.SimulationScreen), y))
+	}
+	return strings.Join(rows, "\n") + "\n"
+}
+
+// checkGolden compares the screen of app with the golden file of given name,
+// or updates the file if the -update flag is given.
+func checkGolden(t *testing.T, app *App, name string) {
+	t.Helper()
+
+	app.redraw()
+	actual := screenText(app)
+
+	path := filepath.Join("testdata", "screens", name+".txt")
+	if *updateGolden {
+		if err := ioutil.WriteFile(path, []byte(actual), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("cannot read golden screen: %s", err)
+	}
+
+	if expected := string(data); actual != expected {
+		t.Errorf("screen %s differs from the golden file:\n%s\nwant:\n%s", name, actual, expected)
+	}
+}
+
+func Test_App_GoldenScreens(t *testing.T) {
+	sizes := []struct{ w, h int }{
+		{100, 30},
+		{80, 24},
+		{60, 14},
+		{40, 10},
+	}
+
+	for _, size := range sizes {
+		name := fmt.Sprintf("cluster-%dx%d", size.w, size.h)
+		t.Run(name, func(t *testing.T) {
+			app := newGoldenApp(t, size.w, size.h, []Cluster{goldenCluster("alpha")})
+			defer app.scr.Fini()
+
+			queryAll(app)
+			checkGolden(t, app, name)
+		})
+	}
+}
+
+func Test_App_GoldenScreens_Tabs(t *testing.T) {
+	app := newGoldenApp(t, 80, 24, []Cluster{goldenCluster("alpha"), goldenCluster("beta")})
+	defer app.scr.Fini()
+
+	queryAll(app)
+
+	app.switchTab(1)
+	checkGolden(t, app, "tabs-80x24")
+}
+
+func Test_App_GoldenScreens_Grouped(t *testing.T) {
+	app := newGoldenApp(t, 80, 24, []Cluster{goldenCluster("alpha")})
+	defer app.scr.Fini()
+
+	queryAll(app)
+	app.setOptions(func(opts *Options) {
+		opts.Grouping.Mode = GroupByOwner
+	})
+	checkGolden(t, app, "grouped-80x24")
+}
+
+func Test_App_GoldenScreens_Loading(t *testing.T) {
+	src := newScriptedSource()
+	defer func() { src.outcomes <- errors.New("closed") }()
+
+	app := newGoldenApp(t, 80, 24, []Cluster{{Name: "slow", Top: NewSourceTop(src)}})
+	defer app.scr.Fini()
+
+	app.refreshAll()
+
+	checkGolden(t, app, "loading-80x24")
+}
+
+func Test_App_GoldenScreens_Error(t *testing.T) {
+	src := newScriptedSource()
+	src.snap = goldenSnapshot(goldenClock.Add(-90 * time.Second))
+
+	app := newGoldenApp(t, 80, 24, []Cluster{{Name: "flaky", Top: NewSourceTop(src)}})
+	defer app.scr.Fini()
+
+	app.refreshAll()
+	src.outcomes <- nil
+	app.receive(<-app.results)
+
+	app.refreshAll()
+	src.outcomes <- errors.New("connection refused")
+	app.receive(<-app.results)
+
+	checkGolden(t, app, "error-80x24")
+}
+
+func Test_App_GoldenScreens_Help(t *testing.T) {
+	app := newGoldenApp(t, 80, 24, []Cluster{goldenCluster("alpha")})
+	defer app.scr.Fini()
+
+	queryAll(app)
+	app.openHelp()
+	checkGolden(t, app, "help-80x24")
+}
+
+// sequenceSource is a Source returning the snapshots in order, repeating the
+// last one.
+type sequenceSource struct {
+	snaps []*Snapshot
+}
+
+func (src *sequenceSource) Query() (*Snapshot, error) {
+	snap := src.snaps[0]
+	if len(src.snaps) > 1 {
+		src.snaps = src.snaps[1:]
+	}
+	return snap, nil
+}
+
+func (src *sequenceSource) Close() error {
+	return nil
+}
+
+func Test_App_GoldenScreens_Trends(t *testing.T) {
+	const updates = 6
+
+	src := &sequenceSource{}
+	for i := 0; i < updates; i++ {
+		snap := goldenSnapshot(goldenClock.Add(time.Duration(i-updates) * time.Minute))
+
+		// The relaxation speeds up, and bob's and dave's jobs come later.
+		jobs := []torque.Job{}
+		for _, job := range snap.Jobs {
+			switch {
+			case job.ID == "1001.server":
+				job.CPUTime = job.CPUTime * (i + 1) / updates
+			case job.ID == "1002.server" && i < 3:
+				continue
+			case job.ID == "1006.server" && i < 4:
+				continue
+			}
+			jobs = append(jobs, job)
+		}
+		snap.Jobs = jobs
+
+		src.snaps = append(src.snaps, snap)
+	}
+
+	top := NewSourceTop(src)
+	top.SetOptions(Options{History: 10})
+
+	app := newGoldenApp(t, 80, 24, []Cluster{{Name: "alpha", Top: top}})
+	app.columns = selectJobColumns(defaultColumns(10))
+	defer app.scr.Fini()
+
+	for i := 0; i < updates; i++ {
+		queryAll(app)
+	}
+	checkGolden(t, app, "trends-80x24")
+}
+
+// modelRecorder is a renderer keeping the last screen model instead of
+// drawing it.
+type modelRecorder struct {
+	model *screenModel
+}
+
+func (r *modelRecorder) render(m *screenModel) {
+	r.model = m
+}
+
+func Test_App_RendersLaidOutModel(t *testing.T) {
+	app := newGoldenApp(t, 80, 24, []Cluster{goldenCluster("alpha")})
+	defer app.scr.Fini()
+
+	rec := &modelRecorder{}
+	app.renderer = rec
+
+	queryAll(app)
+	app.redraw()
+	app.focusedView().move(2)
+	app.redraw()
+
+	c := rec.model.cluster
+	if c == nil {
+		t.Fatalf("cluster is not shown")
+	}
+	if c.jobs.header != app.header || c.jobs.view != app.jobView || c.nodes.view != app.nodeView {
+		t.Errorf("model does not follow the layout")
+	}
+	if n := len(c.jobs.rows); n != app.jobView.total {
+		t.Errorf("unexpected number of job rows: %d", n)
+	}
+	jobs := app.clusters[0].Top.Current().Jobs
+	if row := c.jobs.rows[app.jobView.cursor].job; app.jobView.cursor != 2 || row == nil || row.job.Name != jobs[2].Name {
+		t.Errorf("unexpected selected row: %d", app.jobView.cursor)
+	}
+	if rec.model.clock != "Jun  1 12:00:00" {
+		t.Errorf("unexpected clock: %q", rec.model.clock)
+	}
+
+	// Building and drawing the model leaves the layout as it is.
+	header, jobView := app.header, app.jobView
+	app.model()
+	app.renderer = newTestRenderer(app.scr)
+	app.renderer.render(rec.model)
+	if app.header != header || app.jobView != jobView {
+		t.Errorf("drawing changes the layout")
+	}
+}
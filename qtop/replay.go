@@ -0,0 +1,211 @@
+package qtop
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	minPlaybackSpeed = 1.0 / 16
+	maxPlaybackSpeed = 256
+)
+
+// A Player replays recorded frames. Clusters returned by the Player show the
+// recorded snapshots at the playback position.
+type Player struct {
+	frames []Frame
+	times  []time.Time
+	mutex  sync.Mutex
+	pos    time.Time
+	speed  float64
+	paused bool
+}
+
+// NewPlayer creates a Player replaying frames sorted by time. Playback starts
+// at the first frame.
+func NewPlayer(frames []Frame) (*Player, error) {
+	if len(frames) == 0 {
+		return nil, errors.New("recording is empty")
+	}
+
+	// Frames recorded in a single refresh of multiple clusters have slightly
+	// different times. Group them into one step that ends at the last frame.
+	times := []time.Time{}
+	seen := map[string]bool{}
+
+	for _, frame := range frames {
+		if len(times) == 0 || seen[frame.Cluster] {
+			times = append(times, frame.Snapshot.Time)
+			seen = map[string]bool{}
+		}
+		seen[frame.Cluster] = true
+		times[len(times)-1] = frame.Snapshot.Time
+	}
+
+	player := &Player{
+		frames: frames,
+		times:  times,
+		pos:    times[0],
+		speed:  1,
+	}
+	return player, nil
+}
+
+// Clusters returns a Cluster for each cluster appearing in the recording.
+func (p *Player) Clusters() []Cluster {
+	clusters := []Cluster{}
+	seen := map[string]bool{}
+
+	for _, frame := range p.frames {
+		if seen[frame.Cluster] {
+			continue
+		}
+		seen[frame.Cluster] = true
+
+		clusters = append(clusters, Cluster{
+			Name: frame.Cluster,
+			Top:  NewSourceTop(playerSource{p, frame.Cluster}),
+		})
+	}
+
+	return clusters
+}
+
+// Advance moves the playback position forward by d scaled by the playback
+// speed unless the playback is paused. Playback pauses at the end.
+func (p *Player) Advance(d time.Duration) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.paused {
+		return
+	}
+
+	p.pos = p.pos.Add(time.Duration(float64(d) * p.speed))
+
+	if end := p.times[len(p.times)-1]; !p.pos.Before(end) {
+		p.pos = end
+		p.paused = true
+	}
+}
+
+// Step moves the playback position by n frames.
+func (p *Player) Step(n int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	i := p.index() + n
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(p.times) {
+		i = len(p.times) - 1
+	}
+	p.pos = p.times[i]
+}
+
+// TogglePause pauses or resumes the playback.
+func (p *Player) TogglePause() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.paused = !p.paused
+}
+
+// Paused returns true if the playback is paused.
+func (p *Player) Paused() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.paused
+}
+
+// ScaleSpeed multiplies the playback speed by factor.
+func (p *Player) ScaleSpeed(factor float64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.speed *= factor
+
+	if p.speed < minPlaybackSpeed {
+		p.speed = minPlaybackSpeed
+	}
+	if p.speed > maxPlaybackSpeed {
+		p.speed = maxPlaybackSpeed
+	}
+}
+
+// Time returns the playback position.
+func (p *Player) Time() time.Time {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.pos
+}
+
+// Status returns a short description of the playback state.
+func (p *Player) Status() string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	state := "playing"
+	if p.paused {
+		state = "paused"
+	}
+
+	return fmt.Sprintf(
+		"replay %d/%d %gx %s",
+		p.index()+1,
+		len(p.times),
+		p.speed,
+		state,
+	)
+}
+
+// index returns the index of the last frame time not after the playback
+// position.
+func (p *Player) index() int {
+	i := 0
+	for i+1 < len(p.times) && !p.times[i+1].After(p.pos) {
+		i++
+	}
+	return i
+}
+
+// snapshot returns the latest snapshot of the named cluster at the playback
+// position, or the first snapshot of the cluster if the cluster is recorded
+// only after the position.
+func (p *Player) snapshot(cluster string) *Snapshot {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var snap *Snapshot
+
+	for _, frame := range p.frames {
+		if frame.Cluster != cluster {
+			continue
+		}
+
+		if snap != nil && frame.Snapshot.Time.After(p.pos) {
+			break
+		}
+		snap = frame.Snapshot
+	}
+
+	return snap
+}
+
+type playerSource struct {
+	player  *Player
+	cluster string
+}
+
+func (src playerSource) Query() (*Snapshot, error) {
+	return src.player.snapshot(src.cluster), nil
+}
+
+func (src playerSource) Close() error {
+	return nil
+}
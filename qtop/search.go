@@ -0,0 +1,140 @@
+package qtop
+
+import "strings"
+
+// A searchHit locates a row matching the search query.
+type searchHit struct {
+	pane  pane
+	index int
+}
+
+// before returns true if hit comes before the given row in the search order:
+// nodes first and then jobs.
+func (hit searchHit) before(p pane, index int) bool {
+	if hit.pane != p {
+		return hit.pane < p
+	}
+	return hit.index < index
+}
+
+// matchJobQuery tests if the name, the owner or any of the IDs of a job group
+// contains query, ignoring case.
+func matchJobQuery(job JobSummary, query string) bool {
+	if query == "" {
+		return false
+	}
+
+	if containsFold(job.Name, query) || containsFold(job.Owner, query) {
+		return true
+	}
+
+	for _, id := range job.IDs {
+		if containsFold(id, query) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchNodeQuery tests if the name of a node contains query, ignoring case.
+func matchNodeQuery(node NodeSummary, query string) bool {
+	return query != "" && containsFold(node.Name, query)
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// openSearchPrompt prompts for a search query. The cursor jumps to the first
+// match as the query is typed. Esc clears the search.
+func (app *App) openSearchPrompt() {
+	app.prompt = newPrompt("search", "", func(string) error {
+		return nil
+	})
+
+	app.prompt.change = func(query string) {
+		app.search = query
+		app.jumpToMatch(1, true)
+	}
+
+	app.prompt.cancel = func() {
+		app.search = ""
+	}
+}
+
+// searchHits lists the rows matching the search query in the current tab.
+func (app *App) searchHits() []searchHit {
+	hits := []searchHit{}
+
+	if app.showsMine() {
+		for i, row := range app.mineRows() {
+			if row.job != nil && matchJobQuery(*row.job, app.search) {
+				hits = append(hits, searchHit{paneJobs, i})
+			}
+		}
+		return hits
+	}
+
+	sum := app.clusters[app.tab].Top.Current()
+	if sum == nil {
+		return hits
+	}
+
+	for i, node := range sum.Nodes {
+		if matchNodeQuery(node, app.search) {
+			hits = append(hits, searchHit{paneNodes, i})
+		}
+	}
+
+	for i, job := range sum.Jobs {
+		if matchJobQuery(job, app.search) {
+			hits = append(hits, searchHit{paneJobs, i})
+		}
+	}
+
+	return hits
+}
+
+// jumpToMatch moves the focus and the cursor to the next match after the
+// selected row, or the previous one if dir is negative, wrapping around at the
+// end. The selected row itself is a candidate if inclusive is true.
+func (app *App) jumpToMatch(dir int, inclusive bool) {
+	hits := app.searchHits()
+	if len(hits) == 0 {
+		return
+	}
+
+	focus := app.focus
+	if app.showsMine() {
+		focus = paneJobs
+	}
+	cursor := app.focusedView().cursor
+
+	var next searchHit
+
+	if dir > 0 {
+		next = hits[0]
+		for _, hit := range hits {
+			current := hit.pane == focus && hit.index == cursor
+			if (inclusive && current) || !(hit.before(focus, cursor) || current) {
+				next = hit
+				break
+			}
+		}
+	} else {
+		next = hits[len(hits)-1]
+		for i := len(hits) - 1; i >= 0; i-- {
+			hit := hits[i]
+			current := hit.pane == focus && hit.index == cursor
+			if (inclusive && current) || hit.before(focus, cursor) {
+				next = hit
+				break
+			}
+		}
+	}
+
+	app.focus = next.pane
+	view := app.focusedView()
+	view.move(next.index - view.cursor)
+}
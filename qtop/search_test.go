@@ -0,0 +1,40 @@
+package qtop
+
+import (
+	"testing"
+)
+
+func Test_matchJobQuery_SearchesNameOwnerAndIDs(t *testing.T) {
+	job := JobSummary{
+		Name:  "sim",
+		Owner: "alice@login",
+		IDs:   []string{"101.server", "102.server"},
+	}
+
+	testCases := []struct {
+		query string
+		match bool
+	}{
+		{"", false},
+		{"SIM", true},
+		{"alice", true},
+		{"102", true},
+		{"bob", false},
+	}
+
+	for _, tc := range testCases {
+		if actual := matchJobQuery(job, tc.query); actual != tc.match {
+			t.Errorf("%q: got %v, want %v", tc.query, actual, tc.match)
+		}
+	}
+}
+
+func Test_searchHit_OrdersNodesBeforeJobs(t *testing.T) {
+	if !(searchHit{paneNodes, 5}).before(paneJobs, 0) {
+		t.Error("node should come before job")
+	}
+
+	if (searchHit{paneJobs, 3}).before(paneJobs, 3) {
+		t.Error("hit should not come before itself")
+	}
+}
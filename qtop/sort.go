@@ -0,0 +1,180 @@
+package qtop
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A SortKey is a column to order job groups by.
+type SortKey int
+
+// Sort keys in the order cycled through in the App. SortOwner orders job
+// groups by owner, name and state, which is the default order.
+const (
+	SortOwner SortKey = iota
+	SortName
+	SortState
+	SortCount
+	SortOccupancy
+	SortCPUUsage
+	SortMaxWalltime
+	SortID
+	SortQueueTime
+	SortQueue
+	SortRequestedWalltime
+	SortMemory
+	sortKeyCount
+)
+
+// sortNone marks a column that job groups cannot be ordered by.
+const sortNone SortKey = -1
+
+var sortKeyNames = []string{
+	"owner",
+	"name",
+	"state",
+	"njob",
+	"ncpu",
+	"cpu",
+	"time",
+	"id",
+	"qtime",
+	"queue",
+	"wall",
+	"mem",
+}
+
+// ParseSortKey returns the sort key with given name.
+func ParseSortKey(name string) (SortKey, error) {
+	for i, keyName := range sortKeyNames {
+		if keyName == name {
+			return SortKey(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown sort key %q", name)
+}
+
+func (key SortKey) String() string {
+	if key < 0 || key >= sortKeyCount {
+		return strconv.Itoa(int(key))
+	}
+	return sortKeyNames[key]
+}
+
+// A JobOrder specifies the order of job groups. The zero JobOrder is the
+// default order.
+type JobOrder struct {
+	Key        SortKey
+	Descending bool
+}
+
+// Next returns the order by the delta-th next key in the same direction.
+func (order JobOrder) Next(delta int) JobOrder {
+	n := int(sortKeyCount)
+	order.Key = SortKey(((int(order.Key)+delta)%n + n) % n)
+	return order
+}
+
+// Reverse returns the order in the opposite direction.
+func (order JobOrder) Reverse() JobOrder {
+	order.Descending = !order.Descending
+	return order
+}
+
+// Less reports whether job group a comes before b. Groups equal in the sort
+// key are ordered in the default order regardless of the direction, and then
+// by job ID.
+func (order JobOrder) Less(a, b JobSummary) bool {
+	r := order.compare(a, b)
+	if order.Descending {
+		r = -r
+	}
+
+	if r == 0 {
+		r = compareJobs(a, b)
+	}
+
+	// Keep groups of the same name in a stable order.
+	if r == 0 {
+		r = compareInt(firstJobNumber(a.IDs), firstJobNumber(b.IDs))
+	}
+	return r < 0
+}
+
+func (order JobOrder) compare(a, b JobSummary) int {
+	switch order.Key {
+	case SortOwner:
+		return compareJobs(a, b)
+
+	case SortName:
+		return strings.Compare(a.Name, b.Name)
+
+	case SortState:
+		return strings.Compare(a.State, b.State)
+
+	case SortCount:
+		return compareInt(int64(a.Count), int64(b.Count))
+
+	case SortOccupancy:
+		return compareInt(int64(a.Occupancy), int64(b.Occupancy))
+
+	case SortCPUUsage:
+		return compareInt(int64(a.CPUUsage*1000), int64(b.CPUUsage*1000))
+
+	case SortMaxWalltime:
+		return compareInt(int64(a.MaxWalltime), int64(b.MaxWalltime))
+
+	case SortID:
+		return compareInt(firstJobNumber(a.IDs), firstJobNumber(b.IDs))
+
+	case SortQueueTime:
+		return compareInt(a.QueueTime, b.QueueTime)
+
+	case SortQueue:
+		return strings.Compare(a.Queue, b.Queue)
+
+	case SortRequestedWalltime:
+		return compareInt(int64(a.RequestedWalltime), int64(b.RequestedWalltime))
+
+	case SortMemory:
+		return compareInt(a.Memory, b.Memory)
+	}
+
+	return 0
+}
+
+// firstJobNumber returns the smallest sequence number in the job IDs. The
+// sequence number is the leading digits of a job ID like "123.server" or
+// "123[4].server".
+func firstJobNumber(ids []string) int64 {
+	first := int64(-1)
+
+	for _, id := range ids {
+		end := 0
+		for end < len(id) && id[end] >= '0' && id[end] <= '9' {
+			end++
+		}
+
+		n, err := strconv.ParseInt(id[:end], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		if first == -1 || n < first {
+			first = n
+		}
+	}
+
+	return first
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
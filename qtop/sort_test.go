@@ -0,0 +1,74 @@
+package qtop
+
+import (
+	"testing"
+
+	"github.com/snsinfu/torque-qtop/torque"
+)
+
+func Test_SummarizeJobs_SortsByKey(t *testing.T) {
+	jobs := []torque.Job{
+		{ID: "3.server", Name: "a", Owner: "bob", State: "Q", QueueTime: 300},
+		{ID: "1.server", Name: "b", Owner: "alice", State: "Q", QueueTime: 200},
+		{ID: "4.server", Name: "b", Owner: "alice", State: "Q", QueueTime: 400},
+		{ID: "2.server", Name: "c", Owner: "carol", State: "Q", QueueTime: 100},
+	}
+
+	testCases := []struct {
+		order JobOrder
+		names []string
+	}{
+		{JobOrder{}, []string{"b", "a", "c"}},
+		{JobOrder{Key: SortOwner, Descending: true}, []string{"c", "a", "b"}},
+		{JobOrder{Key: SortName}, []string{"a", "b", "c"}},
+		{JobOrder{Key: SortCount, Descending: true}, []string{"b", "a", "c"}},
+		{JobOrder{Key: SortID}, []string{"b", "c", "a"}},
+		{JobOrder{Key: SortQueueTime}, []string{"c", "b", "a"}},
+	}
+
+	for _, tc := range testCases {
+		sums := SummarizeJobs(jobs, Grouping{}, tc.order)
+
+		names := []string{}
+		for _, sum := range sums {
+			names = append(names, sum.Name)
+		}
+
+		if len(names) != len(tc.names) {
+			t.Fatalf("unexpected number of groups: %d", len(names))
+		}
+
+		for i := range names {
+			if names[i] != tc.names[i] {
+				t.Errorf("%v: got %v, want %v", tc.order, names, tc.names)
+				break
+			}
+		}
+	}
+}
+
+func Test_JobOrder_Next_Wraps(t *testing.T) {
+	order := JobOrder{Key: SortOwner, Descending: true}
+
+	prev := order.Next(-1)
+	if prev.Key != SortMemory || !prev.Descending {
+		t.Errorf("unexpected order: %v", prev)
+	}
+
+	if next := prev.Next(1); next != order {
+		t.Errorf("unexpected order: %v", next)
+	}
+}
+
+func Test_ParseSortKey_AcceptsKeyNames(t *testing.T) {
+	for key := SortOwner; key < sortKeyCount; key++ {
+		parsed, err := ParseSortKey(key.String())
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if parsed != key {
+			t.Errorf("%s: got %v", key, parsed)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package qtop
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/snsinfu/torque-qtop/torque"
+)
+
+var errSourceClosed = errors.New("source is closed")
+
+// A Source retrieves snapshots of a cluster.
+type Source interface {
+	// Query returns the current snapshot of the cluster.
+	Query() (*Snapshot, error)
+
+	// Close releases any resources held by the source. It may be called
+	// during a query, which then fails.
+	Close() error
+}
+
+// A JobDetailer is a Source that can retrieve all the attributes of a job.
+type JobDetailer interface {
+	// QueryJobAttrs returns the attributes of the job with given ID.
+	QueryJobAttrs(id string) (map[string]string, error)
+}
+
+// ConnSource returns a Source that queries a PBS server through conn.
+func ConnSource(conn torque.Conn) Source {
+	return connSource{conn}
+}
+
+type connSource struct {
+	conn torque.Conn
+}
+
+func (src connSource) Query() (*Snapshot, error) {
+	start := time.Now()
+
+	nodes, err := torque.QueryNodes(src.conn)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs, err := torque.QueryJobs(src.conn)
+	if err != nil {
+		return nil, err
+	}
+
+	snap := &Snapshot{
+		Time:  start,
+		Nodes: nodes,
+		Jobs:  jobs,
+	}
+	return snap, nil
+}
+
+func (src connSource) Close() error {
+	return src.conn.Close()
+}
+
+func (src connSource) QueryJobAttrs(id string) (map[string]string, error) {
+	return torque.QueryJobAttrs(src.conn, id)
+}
+
+// RedialSource returns a Source that queries a PBS server through conn. The
+// connection is closed on a failed query, whose state on the connection is
+// unknown, and a new one is made with dial for the next query so that the
+// source recovers when the server comes back. Close may be called during a
+// query, which then fails.
+func RedialSource(conn torque.Conn, dial func() (torque.Conn, error)) Source {
+	return &redialSource{conn: conn, dial: dial}
+}
+
+type redialSource struct {
+	dial func() (torque.Conn, error)
+
+	// mutex guards conn and closed, but is not held during a query so that
+	// Close can interrupt it.
+	mutex  sync.Mutex
+	conn   torque.Conn
+	closed bool
+}
+
+func (src *redialSource) Query() (*Snapshot, error) {
+	conn, err := src.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	snap, err := connSource{conn}.Query()
+	if err != nil {
+		src.drop(conn)
+	}
+	return snap, err
+}
+
+func (src *redialSource) QueryJobAttrs(id string) (map[string]string, error) {
+	conn, err := src.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	attrs, err := torque.QueryJobAttrs(conn, id)
+	if err != nil {
+		src.drop(conn)
+	}
+	return attrs, err
+}
+
+func (src *redialSource) Close() error {
+	src.mutex.Lock()
+	defer src.mutex.Unlock()
+
+	src.closed = true
+	if src.conn == nil {
+		return nil
+	}
+	err := src.conn.Close()
+	src.conn = nil
+	return err
+}
+
+// connect returns the current connection, making a new one if the last one is
+// dropped.
+func (src *redialSource) connect() (torque.Conn, error) {
+	src.mutex.Lock()
+	defer src.mutex.Unlock()
+
+	if src.closed {
+		return nil, errSourceClosed
+	}
+	if src.conn != nil {
+		return src.conn, nil
+	}
+
+	conn, err := src.dial()
+	if err != nil {
+		return nil, err
+	}
+	src.conn = conn
+	return conn, nil
+}
+
+// drop closes conn after a failed query unless the source has moved on to
+// another connection or has been closed.
+func (src *redialSource) drop(conn torque.Conn) {
+	src.mutex.Lock()
+	defer src.mutex.Unlock()
+
+	if src.conn == conn {
+		conn.Close()
+		src.conn = nil
+	}
+}
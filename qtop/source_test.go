@@ -0,0 +1,134 @@
+package qtop
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/snsinfu/torque-qtop/torque"
+)
+
+// brokenConn is a torque.Conn whose writes always fail.
+type brokenConn struct {
+	closed bool
+}
+
+func (c *brokenConn) User() string                { return "alice" }
+func (c *brokenConn) ReadInt() (int64, error)     { return 0, errors.New("broken") }
+func (c *brokenConn) ReadString() (string, error) { return "", errors.New("broken") }
+func (c *brokenConn) WriteInt(n int64) error      { return nil }
+func (c *brokenConn) WriteString(s string) error  { return nil }
+func (c *brokenConn) Flush() error                { return errors.New("broken") }
+
+func (c *brokenConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+func Test_RedialSource_ReconnectsAfterFailure(t *testing.T) {
+	first := &brokenConn{}
+	conns := []*brokenConn{}
+	dial := func() (torque.Conn, error) {
+		conn := &brokenConn{}
+		conns = append(conns, conn)
+		return conn, nil
+	}
+
+	src := RedialSource(first, dial)
+
+	if _, err := src.Query(); err == nil {
+		t.Fatal("expected error")
+	}
+	if !first.closed {
+		t.Error("failed connection is not closed")
+	}
+	if len(conns) != 0 {
+		t.Error("redialed before next query")
+	}
+
+	if _, err := src.Query(); err == nil {
+		t.Fatal("expected error")
+	}
+	if len(conns) != 1 || !conns[0].closed {
+		t.Errorf("unexpected connections: %v", conns)
+	}
+}
+
+func Test_RedialSource_ReportsDialError(t *testing.T) {
+	dial := func() (torque.Conn, error) {
+		return nil, errors.New("connection refused")
+	}
+
+	src := RedialSource(&brokenConn{}, dial)
+	src.Query()
+
+	if _, err := src.Query(); err == nil || err.Error() != "connection refused" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := src.Close(); err != nil {
+		t.Errorf("unexpected error on close: %s", err)
+	}
+}
+
+// blockingConn is a torque.Conn whose reads block until it is closed.
+type blockingConn struct {
+	done chan struct{}
+}
+
+func (c *blockingConn) User() string               { return "alice" }
+func (c *blockingConn) WriteInt(n int64) error     { return nil }
+func (c *blockingConn) WriteString(s string) error { return nil }
+func (c *blockingConn) Flush() error               { return nil }
+
+func (c *blockingConn) ReadInt() (int64, error) {
+	<-c.done
+	return 0, errors.New("closed")
+}
+
+func (c *blockingConn) ReadString() (string, error) {
+	<-c.done
+	return "", errors.New("closed")
+}
+
+func (c *blockingConn) Close() error {
+	close(c.done)
+	return nil
+}
+
+func Test_Top_Close_InterruptsQuery(t *testing.T) {
+	dialed := false
+	dial := func() (torque.Conn, error) {
+		dialed = true
+		return &brokenConn{}, nil
+	}
+
+	top := NewSourceTop(RedialSource(&blockingConn{done: make(chan struct{})}, dial))
+
+	errs := make(chan error)
+	go func() {
+		errs <- top.Update()
+	}()
+
+	// Let the query block on the connection.
+	time.Sleep(10 * time.Millisecond)
+
+	if err := top.Close(); err != nil {
+		t.Fatalf("unexpected error on close: %s", err)
+	}
+
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Error("expected error")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("query is not interrupted")
+	}
+
+	if err := top.Update(); err != errSourceClosed {
+		t.Errorf("unexpected error after close: %v", err)
+	}
+	if dialed {
+		t.Error("redialed after close")
+	}
+}
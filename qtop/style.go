@@ -0,0 +1,225 @@
+package qtop
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell"
+)
+
+// Style roles. Each piece of the screen is drawn in the style of a role, which
+// can be changed in the configuration file.
+const (
+	roleTab       = "tab"
+	roleTabActive = "tab.active"
+	roleHeader    = "header"
+	roleDim       = "dim"
+	roleNode      = "node"
+	roleNodeDown  = "node.down"
+	roleRunning   = "state.running"
+	roleDone      = "state.done"
+	roleWaiting   = "state.waiting"
+	roleJID       = "jid"
+	roleFocus     = "focus"
+	roleCursor    = "cursor"
+	roleMatch     = "match"
+	roleHeading   = "heading"
+	roleNotice    = "notice"
+	roleError     = "error"
+	roleTrend     = "trend"
+	rolePrompt    = "prompt"
+	roleOwnerMe   = "owner.me"
+)
+
+// Styles maps style roles to styles.
+type Styles map[string]tcell.Style
+
+// DefaultStyles returns the styles of all the roles in the default theme.
+func DefaultStyles() Styles {
+	theme, _ := LoadTheme(DefaultTheme)
+	return theme.Styles
+}
+
+// Roles returns the names of the style roles in alphabetical order.
+func (styles Styles) Roles() []string {
+	roles := []string{}
+	for role := range styles {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+// Override replaces the styles of roles with the styles given as strings
+// accepted by ParseStyle.
+func (styles Styles) Override(specs map[string]string) error {
+	for role, spec := range specs {
+		if _, ok := styles[role]; !ok {
+			return fmt.Errorf("unknown colour role %q", role)
+		}
+
+		style, err := ParseStyle(spec)
+		if err != nil {
+			return fmt.Errorf("colour of %s: %s", role, err)
+		}
+		styles[role] = style
+	}
+	return nil
+}
+
+// Specs returns the styles of all the roles as strings accepted by Override.
+func (styles Styles) Specs() map[string]string {
+	specs := map[string]string{}
+	for role, style := range styles {
+		specs[role] = formatStyle(style)
+	}
+	return specs
+}
+
+// styleAttrs lists the names of the text attributes usable in styles.
+var styleAttrs = []struct {
+	name string
+	mask tcell.AttrMask
+	set  func(tcell.Style, bool) tcell.Style
+}{
+	{"bold", tcell.AttrBold, tcell.Style.Bold},
+	{"dim", tcell.AttrDim, tcell.Style.Dim},
+	{"underline", tcell.AttrUnderline, tcell.Style.Underline},
+	{"reverse", tcell.AttrReverse, tcell.Style.Reverse},
+	{"blink", tcell.AttrBlink, tcell.Style.Blink},
+}
+
+// ParseStyle parses a style string of the form "fg[:bg] [attr...]" like
+// "black:green bold". Colours are names like "green" or hex codes like
+// "#00ff00", and an empty colour or "default" keeps the terminal default.
+// Attributes are bold, dim, underline, reverse and blink. The colours may be
+// omitted, as in "reverse".
+func ParseStyle(spec string) (tcell.Style, error) {
+	style := tcell.StyleDefault
+	colors := ""
+
+	for _, word := range strings.Fields(spec) {
+		attr := false
+		for _, a := range styleAttrs {
+			if strings.EqualFold(word, a.name) {
+				style = a.set(style, true)
+				attr = true
+			}
+		}
+		if attr {
+			continue
+		}
+
+		if colors != "" {
+			return style, fmt.Errorf("unknown attribute %q", word)
+		}
+		colors = word
+	}
+
+	fg, bg := colors, ""
+	if n := strings.Index(colors, ":"); n != -1 {
+		fg, bg = colors[:n], colors[n+1:]
+	}
+
+	if fg != "" {
+		color, err := parseColor(fg)
+		if err != nil {
+			return style, err
+		}
+		style = style.Foreground(color)
+	}
+
+	if bg != "" {
+		color, err := parseColor(bg)
+		if err != nil {
+			return style, err
+		}
+		style = style.Background(color)
+	}
+
+	return style, nil
+}
+
+func parseColor(name string) (tcell.Color, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "default" {
+		return tcell.ColorDefault, nil
+	}
+
+	color := tcell.GetColor(name)
+	if color == tcell.ColorDefault {
+		return color, fmt.Errorf("unknown colour %q", name)
+	}
+	return color, nil
+}
+
+// formatStyle returns the string of a style accepted by ParseStyle.
+func formatStyle(style tcell.Style) string {
+	fg, bg, attrs := style.Decompose()
+	words := []string{}
+
+	switch {
+	case bg != tcell.ColorDefault:
+		words = append(words, formatColor(fg)+":"+formatColor(bg))
+	case fg != tcell.ColorDefault || attrs == tcell.AttrNone:
+		words = append(words, formatColor(fg))
+	}
+
+	for _, a := range styleAttrs {
+		if attrs&a.mask != 0 {
+			words = append(words, a.name)
+		}
+	}
+
+	return strings.Join(words, " ")
+}
+
+// formatColor returns the name of a colour, or its hex code if it has no name.
+func formatColor(color tcell.Color) string {
+	if color == tcell.ColorDefault {
+		return "default"
+	}
+
+	names := []string{}
+	for name, c := range tcell.ColorNames {
+		if c == color {
+			names = append(names, name)
+		}
+	}
+	if len(names) > 0 {
+		sort.Strings(names)
+		return names[0]
+	}
+
+	return fmt.Sprintf("#%06x", color.Hex())
+}
+
+// get returns the style of a role, or the default style if the role is
+// unknown.
+func (styles Styles) get(role string) tcell.Style {
+	if style, ok := styles[role]; ok {
+		return style
+	}
+	return tcell.StyleDefault
+}
+
+// highlight returns style with the non-default colours and the attributes of
+// the style of a role laid over it.
+func (styles Styles) highlight(style tcell.Style, role string) tcell.Style {
+	fg, bg, attrs := styles.get(role).Decompose()
+
+	if fg != tcell.ColorDefault {
+		style = style.Foreground(fg)
+	}
+	if bg != tcell.ColorDefault {
+		style = style.Background(bg)
+	}
+	for _, a := range styleAttrs {
+		if attrs&a.mask != 0 {
+			style = a.set(style, true)
+		}
+	}
+
+	return style
+}
@@ -0,0 +1,84 @@
+package qtop
+
+import (
+	"testing"
+
+	"github.com/gdamore/tcell"
+)
+
+func Test_ParseStyle(t *testing.T) {
+	testCases := []struct {
+		spec  string
+		fg    tcell.Color
+		bg    tcell.Color
+		attrs tcell.AttrMask
+	}{
+		{"red", tcell.ColorRed, tcell.ColorDefault, tcell.AttrNone},
+		{"white:blue", tcell.ColorWhite, tcell.ColorBlue, tcell.AttrNone},
+		{":navy", tcell.ColorDefault, tcell.ColorNavy, tcell.AttrNone},
+		{"default:Navy", tcell.ColorDefault, tcell.ColorNavy, tcell.AttrNone},
+		{"#ff0000", tcell.NewHexColor(0xff0000), tcell.ColorDefault, tcell.AttrNone},
+		{"black:green bold", tcell.ColorBlack, tcell.ColorGreen, tcell.AttrBold},
+		{"reverse underline", tcell.ColorDefault, tcell.ColorDefault, tcell.AttrReverse | tcell.AttrUnderline},
+	}
+
+	for _, tc := range testCases {
+		style, err := ParseStyle(tc.spec)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", tc.spec, err)
+			continue
+		}
+
+		fg, bg, attrs := style.Decompose()
+		if fg != tc.fg || bg != tc.bg || attrs != tc.attrs {
+			t.Errorf("%q: got %v:%v %v, want %v:%v %v", tc.spec, fg, bg, attrs, tc.fg, tc.bg, tc.attrs)
+		}
+	}
+}
+
+func Test_ParseStyle_RejectsUnknownColor(t *testing.T) {
+	if _, err := ParseStyle("redish"); err == nil {
+		t.Error("expected error")
+	}
+
+	if _, err := ParseStyle("red bold shiny"); err == nil {
+		t.Error("expected error for unknown attribute")
+	}
+}
+
+func Test_Styles_Override(t *testing.T) {
+	styles := DefaultStyles()
+
+	if err := styles.Override(map[string]string{"dim": "silver"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if fg, _, _ := styles.get(roleDim).Decompose(); fg != tcell.ColorSilver {
+		t.Errorf("unexpected colour: %v", fg)
+	}
+
+	if err := styles.Override(map[string]string{"frame": "red"}); err == nil {
+		t.Error("expected error for unknown role")
+	}
+}
+
+func Test_Styles_Specs_RoundTrips(t *testing.T) {
+	theme, _ := LoadTheme("high-contrast")
+	styles := theme.Styles
+	styles[roleDim] = tcell.StyleDefault
+	styles[roleMatch] = tcell.StyleDefault.Reverse(true)
+
+	parsed := Styles{}
+	for role := range styles {
+		parsed[role] = tcell.StyleDefault
+	}
+	if err := parsed.Override(styles.Specs()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for role, style := range styles {
+		if parsed[role] != style {
+			t.Errorf("%s: style changed", role)
+		}
+	}
+}
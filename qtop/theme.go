@@ -0,0 +1,230 @@
+package qtop
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell"
+)
+
+// DefaultTheme is the name of the theme used if none is specified.
+const DefaultTheme = "dark"
+
+// A Theme is a set of styles of the screen roles with a palette of colours
+// telling owners and jobs apart.
+type Theme struct {
+	Styles Styles
+
+	// Palette lists the colours of the owners other than the current user and
+	// of the jobs in a slot map. A monochrome theme has no palette.
+	Palette []tcell.Color
+}
+
+// themeSpec defines a theme with style strings accepted by ParseStyle.
+type themeSpec struct {
+	styles  map[string]string
+	palette []tcell.Color
+}
+
+var themeSpecs = map[string]themeSpec{
+	// Green is reserved for the current user and gray for free slots.
+	"dark": {
+		styles: map[string]string{
+			roleTab:       "black:gray",
+			roleTabActive: "black:green",
+			roleHeader:    "black:green",
+			roleDim:       "gray",
+			roleNode:      "teal",
+			roleNodeDown:  "gray",
+			roleRunning:   "green",
+			roleDone:      "olive",
+			roleWaiting:   "teal",
+			roleJID:       "teal",
+			roleFocus:     "green",
+			roleCursor:    ":navy",
+			roleMatch:     ":olive",
+			roleHeading:   "teal",
+			roleNotice:    "olive",
+			roleError:     "white:maroon",
+			roleTrend:     "teal",
+			rolePrompt:    "teal",
+			roleOwnerMe:   "green bold",
+		},
+		palette: []tcell.Color{
+			tcell.ColorTeal,
+			tcell.ColorOlive,
+			tcell.ColorPurple,
+			tcell.ColorBlue,
+			tcell.ColorMaroon,
+			tcell.ColorFuchsia,
+			tcell.ColorAqua,
+			tcell.ColorYellow,
+			tcell.ColorRed,
+			tcell.ColorNavy,
+		},
+	},
+
+	// Pale colours like yellow and aqua are avoided on a light background.
+	"light": {
+		styles: map[string]string{
+			roleTab:       "black:silver",
+			roleTabActive: "white:green",
+			roleHeader:    "white:green",
+			roleDim:       "gray",
+			roleNode:      "navy",
+			roleNodeDown:  "gray",
+			roleRunning:   "green",
+			roleDone:      "purple",
+			roleWaiting:   "navy",
+			roleJID:       "navy",
+			roleFocus:     "green",
+			roleCursor:    ":silver",
+			roleMatch:     ":yellow",
+			roleHeading:   "navy",
+			roleNotice:    "maroon",
+			roleError:     "white:maroon",
+			roleTrend:     "navy",
+			rolePrompt:    "navy",
+			roleOwnerMe:   "green bold",
+		},
+		palette: []tcell.Color{
+			tcell.ColorNavy,
+			tcell.ColorPurple,
+			tcell.ColorMaroon,
+			tcell.ColorTeal,
+			tcell.ColorOlive,
+			tcell.ColorBlue,
+			tcell.ColorRed,
+			tcell.ColorFuchsia,
+		},
+	},
+
+	// Bright colours on a dark background, with bold text for emphasis.
+	"high-contrast": {
+		styles: map[string]string{
+			roleTab:       "black:silver",
+			roleTabActive: "black:yellow bold",
+			roleHeader:    "black:yellow bold",
+			roleDim:       "silver",
+			roleNode:      "aqua",
+			roleNodeDown:  "silver",
+			roleRunning:   "lime bold",
+			roleDone:      "yellow",
+			roleWaiting:   "aqua",
+			roleJID:       "aqua",
+			roleFocus:     "yellow",
+			roleCursor:    "white:blue",
+			roleMatch:     "black:fuchsia",
+			roleHeading:   "yellow bold",
+			roleNotice:    "yellow bold",
+			roleError:     "white:red bold",
+			roleTrend:     "aqua",
+			rolePrompt:    "aqua bold",
+			roleOwnerMe:   "lime bold",
+		},
+		palette: []tcell.Color{
+			tcell.ColorAqua,
+			tcell.ColorYellow,
+			tcell.ColorFuchsia,
+			tcell.ColorWhite,
+			tcell.ColorRed,
+			tcell.ColorBlue,
+		},
+	},
+
+	// Attributes only, for terminals without colours and for NO_COLOR.
+	"mono": {
+		styles: map[string]string{
+			roleTab:       "default",
+			roleTabActive: "reverse",
+			roleHeader:    "reverse",
+			roleDim:       "dim",
+			roleNode:      "default",
+			roleNodeDown:  "dim",
+			roleRunning:   "bold",
+			roleDone:      "dim",
+			roleWaiting:   "default",
+			roleJID:       "default",
+			roleFocus:     "bold",
+			roleCursor:    "reverse",
+			roleMatch:     "underline",
+			roleHeading:   "bold",
+			roleNotice:    "bold",
+			roleError:     "reverse bold",
+			roleTrend:     "default",
+			rolePrompt:    "bold",
+			roleOwnerMe:   "bold",
+		},
+	},
+}
+
+// ThemeNames returns the names of the built-in themes in alphabetical order.
+func ThemeNames() []string {
+	names := []string{}
+	for name := range themeSpecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadTheme returns the built-in theme with given name.
+func LoadTheme(name string) (Theme, error) {
+	spec, ok := themeSpecs[name]
+	if !ok {
+		return Theme{}, fmt.Errorf(
+			"unknown theme %q (themes: %s)",
+			name,
+			strings.Join(ThemeNames(), ", "),
+		)
+	}
+
+	theme := Theme{
+		Styles:  Styles{},
+		Palette: spec.palette,
+	}
+
+	for role, styleSpec := range spec.styles {
+		style, err := ParseStyle(styleSpec)
+		if err != nil {
+			panic(fmt.Sprintf("theme %s: %s", name, err))
+		}
+		theme.Styles[role] = style
+	}
+
+	return theme, nil
+}
+
+// Monochrome returns the theme with all the colours removed, keeping only the
+// text attributes.
+func (t Theme) Monochrome() Theme {
+	mono := Theme{Styles: Styles{}}
+
+	for role, style := range t.Styles {
+		_, _, attrs := style.Decompose()
+
+		plain := tcell.StyleDefault
+		for _, a := range styleAttrs {
+			if attrs&a.mask != 0 {
+				plain = a.set(plain, true)
+			}
+		}
+		mono.Styles[role] = plain
+	}
+
+	return mono
+}
+
+// style returns the style of a role.
+func (t Theme) style(role string) tcell.Style {
+	return t.Styles.get(role)
+}
+
+// slotStyle returns the style of the i-th job in a slot map.
+func (t Theme) slotStyle(i int) tcell.Style {
+	if len(t.Palette) == 0 {
+		return tcell.StyleDefault
+	}
+	return tcell.StyleDefault.Foreground(t.Palette[i%len(t.Palette)])
+}
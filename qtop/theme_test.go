@@ -0,0 +1,73 @@
+package qtop
+
+import (
+	"testing"
+
+	"github.com/gdamore/tcell"
+)
+
+func Test_LoadTheme_DefinesAllRoles(t *testing.T) {
+	base, err := LoadTheme(DefaultTheme)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, name := range ThemeNames() {
+		theme, err := LoadTheme(name)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", name, err)
+			continue
+		}
+
+		for _, role := range base.Styles.Roles() {
+			if _, ok := theme.Styles[role]; !ok {
+				t.Errorf("%s: role %s is not defined", name, role)
+			}
+		}
+
+		if len(theme.Styles) != len(base.Styles) {
+			t.Errorf("%s: unexpected number of roles: %d", name, len(theme.Styles))
+		}
+	}
+}
+
+func Test_LoadTheme_RejectsUnknownTheme(t *testing.T) {
+	if _, err := LoadTheme("solarized"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func Test_Theme_Monochrome(t *testing.T) {
+	theme, _ := LoadTheme("high-contrast")
+	mono := theme.Monochrome()
+
+	for role, style := range mono.Styles {
+		fg, bg, _ := style.Decompose()
+		if fg != tcell.ColorDefault || bg != tcell.ColorDefault {
+			t.Errorf("%s: colour is kept", role)
+		}
+	}
+
+	if _, _, attrs := mono.style(roleRunning).Decompose(); attrs&tcell.AttrBold == 0 {
+		t.Error("attribute is removed")
+	}
+
+	if mono.slotStyle(3) != tcell.StyleDefault {
+		t.Error("slot is coloured")
+	}
+}
+
+func Test_Styles_highlight(t *testing.T) {
+	theme, _ := LoadTheme("mono")
+	base := tcell.StyleDefault.Foreground(tcell.ColorRed).Bold(true)
+
+	style := theme.Styles.highlight(base, roleCursor)
+
+	fg, _, attrs := style.Decompose()
+	if fg != tcell.ColorRed {
+		t.Errorf("foreground is changed: %v", fg)
+	}
+	if attrs&tcell.AttrReverse == 0 || attrs&tcell.AttrBold == 0 {
+		t.Errorf("unexpected attributes: %v", attrs)
+	}
+}
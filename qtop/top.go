@@ -1,89 +1,297 @@
 package qtop
 
 import (
+	"errors"
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/snsinfu/torque-qtop/torque"
 )
 
 var jobSuffixPattern = regexp.MustCompile(`-\d+$`)
 
+var errNoJobDetail = errors.New("job attributes are not available from this source")
+
 type Top struct {
-	conn torque.Conn
-	sum  *Summary
+	src Source
+
+	// srcMutex serializes the queries to src made from different goroutines.
+	srcMutex sync.Mutex
+
+	opts    Options
+	sum     *Summary
+	snap    *Snapshot
+	latency time.Duration
+	err     error
+
+	// history keeps the recent summaries, and trend caches the trends taken
+	// from them.
+	history history
+	trend   *trends
 }
 
+// A Snapshot is the raw state of a cluster retrieved at a point in time.
+type Snapshot struct {
+	Time  time.Time     `json:"time"`
+	Nodes []torque.Node `json:"nodes"`
+	Jobs  []torque.Job  `json:"jobs"`
+}
+
+// NewTop creates a Top querying a PBS server through conn.
 func NewTop(conn torque.Conn) *Top {
-	return &Top{conn: conn}
+	return NewSourceTop(ConnSource(conn))
+}
+
+// NewSourceTop creates a Top retrieving snapshots from src.
+func NewSourceTop(src Source) *Top {
+	return &Top{src: src}
+}
+
+// A fetchResult is the outcome of a query made by Top.fetch.
+type fetchResult struct {
+	snap    *Snapshot
+	err     error
+	latency time.Duration
 }
 
 func (top *Top) Update() error {
-	nodes, err := torque.QueryNodes(top.conn)
-	if err != nil {
-		return err
+	return top.apply(top.fetch())
+}
+
+// fetch queries the source for a new snapshot without changing the Top, so
+// that it can run in the background while the Top is in use. The result takes
+// effect when passed to apply.
+func (top *Top) fetch() fetchResult {
+	top.srcMutex.Lock()
+	defer top.srcMutex.Unlock()
+
+	start := time.Now()
+	snap, err := top.src.Query()
+
+	return fetchResult{
+		snap:    snap,
+		err:     err,
+		latency: time.Since(start),
 	}
+}
+
+// apply updates the Top with the result of fetch and returns the error of the
+// query. The current summary is kept if the query has failed.
+func (top *Top) apply(r fetchResult) error {
+	top.err = r.err
+	top.latency = r.latency
 
-	jobs, err := torque.QueryJobs(top.conn)
-	if err != nil {
-		return err
+	if r.err != nil {
+		return r.err
 	}
 
-	sum := Summarize(nodes, jobs)
+	sum := Summarize(r.snap.Nodes, r.snap.Jobs, top.opts)
 	top.sum = &sum
+	top.snap = r.snap
+
+	// Stepping back in a recording starts a new history, and the same
+	// snapshot retrieved again, as from a paused recording or a proxy
+	// refreshing less often, replaces the latest sample.
+	sample := Sample{r.snap.Time, &sum, top.opts.Grouping.Mode}
+	last, ok := top.history.last()
+	switch {
+	case ok && r.snap.Time.Equal(last.Time):
+		top.history.setLast(sample)
+	case ok && r.snap.Time.Before(last.Time):
+		top.history.clear()
+		top.history.add(sample)
+	default:
+		top.history.add(sample)
+	}
+	top.trend = nil
+
 	return nil
 }
 
+// SetOptions changes the options used to summarize the cluster state. The
+// current summary is remade with the new options and replaces the latest one
+// in the history.
+func (top *Top) SetOptions(opts Options) {
+	top.opts = opts
+	top.history.resize(opts.History)
+	top.trend = nil
+
+	if top.snap != nil {
+		sum := Summarize(top.snap.Nodes, top.snap.Jobs, opts)
+		top.sum = &sum
+		top.history.setLast(Sample{top.snap.Time, &sum, opts.Grouping.Mode})
+	}
+}
+
+// Options returns the options used to summarize the cluster state.
+func (top *Top) Options() Options {
+	return top.opts
+}
+
 func (top *Top) Current() *Summary {
 	return top.sum
 }
 
+// History returns the recent summaries from the oldest to the latest.
+func (top *Top) History() []Sample {
+	return top.history.list()
+}
+
+// trends returns the trends taken from the history.
+func (top *Top) trends() *trends {
+	if top.trend == nil {
+		top.trend = makeTrends(top.history.list(), top.opts.Grouping.Mode)
+	}
+	return top.trend
+}
+
+// Snapshot returns the raw nodes and jobs the current summary is made from.
+func (top *Top) Snapshot() *Snapshot {
+	return top.snap
+}
+
+// Latency returns the time taken by the last update.
+func (top *Top) Latency() time.Duration {
+	return top.latency
+}
+
+// Err returns the error occurred in the last update, or nil if the update has
+// succeeded.
+func (top *Top) Err() error {
+	return top.err
+}
+
+// JobAttrs returns all the attributes of the job with given ID. It fails if
+// the source does not support querying job attributes.
+func (top *Top) JobAttrs(id string) (map[string]string, error) {
+	if detailer, ok := top.src.(JobDetailer); ok {
+		top.srcMutex.Lock()
+		defer top.srcMutex.Unlock()
+
+		return detailer.QueryJobAttrs(id)
+	}
+	return nil, errNoJobDetail
+}
+
+// Close closes the source. It does not wait for the query in flight, which
+// fails as the connection underneath is closed.
+func (top *Top) Close() error {
+	return top.src.Close()
+}
+
+// Options controls how Summarize summarizes the cluster state. The zero
+// Options summarizes all the jobs.
+type Options struct {
+	// Filter selects the jobs to summarize. Nodes are always summarized with
+	// all the jobs.
+	Filter Filter
+
+	// Grouping specifies how jobs are grouped.
+	Grouping Grouping
+
+	// Order is the order of the job groups.
+	Order JobOrder
+
+	// History is the number of summaries kept for the trends. No history is
+	// kept if zero.
+	History int
+}
+
 type Summary struct {
-	Cluster ClusterSummary
-	Nodes   []NodeSummary
-	Jobs    []JobSummary
+	Cluster ClusterSummary `json:"cluster"`
+
+	// Global is the summary of all the jobs if Cluster is the summary of the
+	// jobs selected by a filter, or nil otherwise.
+	Global *ClusterSummary `json:"global,omitempty"`
+
+	// Filter is the filter expression selecting the jobs if any.
+	Filter string `json:"filter,omitempty"`
+
+	Nodes []NodeSummary `json:"nodes"`
+	Jobs  []JobSummary  `json:"jobs"`
 }
 
 type ClusterSummary struct {
-	RunningJobs int
-	WaitingJobs int
-	UsedSlots   int
-	FreeSlots   int
+	RunningJobs int `json:"running_jobs"`
+	WaitingJobs int `json:"waiting_jobs"`
+	UsedSlots   int `json:"used_slots"`
+	FreeSlots   int `json:"free_slots"`
 }
 
 type NodeSummary struct {
-	Name       string
-	Active     bool
-	AvailSlots int
-	UsedSlots  int
-	Owners     []NodeOwnerSummary
+	Name       string             `json:"name"`
+	Active     bool               `json:"active"`
+	AvailSlots int                `json:"avail_slots"`
+	UsedSlots  int                `json:"used_slots"`
+	Owners     []NodeOwnerSummary `json:"owners"`
 }
 
 type NodeOwnerSummary struct {
-	Owner     string
-	Occupancy int
+	Owner     string `json:"owner"`
+	Occupancy int    `json:"occupancy"`
 }
 
 type JobSummary struct {
-	Name          string
-	Owner         string
-	State         string
-	Count         int
-	Occupancy     int
-	HostOccupancy map[string]int
-	MinWalltime   int
-	MaxWalltime   int
-	CPUUsage      float64
-	IDs           []string
-}
-
-func Summarize(nodes []torque.Node, jobs []torque.Job) Summary {
-	return Summary{
-		Cluster: SummarizeCluster(nodes, jobs),
+	Name          string         `json:"name"`
+	Owner         string         `json:"owner"`
+	State         string         `json:"state"`
+	Count         int            `json:"count"`
+	Occupancy     int            `json:"occupancy"`
+	HostOccupancy map[string]int `json:"host_occupancy"`
+	MinWalltime   int            `json:"min_walltime"`
+	MaxWalltime   int            `json:"max_walltime"`
+	CPUUsage      float64        `json:"cpu_usage"`
+	QueueTime     int64          `json:"queue_time"`
+	IDs           []string       `json:"ids"`
+
+	// Queue, Account and ExitStatus list the distinct values of the jobs
+	// separated by commas.
+	Queue      string `json:"queue"`
+	Account    string `json:"account,omitempty"`
+	ExitStatus string `json:"exit_status,omitempty"`
+
+	// RequestedWalltime is the longest walltime requested by the jobs.
+	RequestedWalltime int `json:"requested_walltime"`
+
+	// Memory is the total memory in bytes used by the running jobs.
+	Memory int64 `json:"memory"`
+}
+
+// Summarize summarizes the cluster state. If opts has a filter, the job list
+// and the cluster totals only count the selected jobs, except for the free
+// slots which are always counted globally.
+func Summarize(nodes []torque.Node, jobs []torque.Job, opts Options) Summary {
+	selected := opts.Filter.Apply(jobs)
+
+	sum := Summary{
+		Cluster: SummarizeCluster(nodes, selected),
 		Nodes:   SummarizeNodes(nodes, jobs),
-		Jobs:    SummarizeJobs(jobs),
+		Jobs:    SummarizeJobs(selected, opts.Grouping, opts.Order),
+	}
+
+	if !opts.Filter.IsEmpty() {
+		global := SummarizeCluster(nodes, jobs)
+		sum.Cluster.FreeSlots = global.FreeSlots
+		sum.Global = &global
+		sum.Filter = opts.Filter.String()
 	}
+
+	return sum
+}
+
+// Capacity returns the number of slots on the active nodes. Unlike the cluster
+// totals, it does not depend on the filter.
+func (s *Summary) Capacity() int {
+	capacity := 0
+	for _, node := range s.Nodes {
+		if node.Active {
+			capacity += node.AvailSlots
+		}
+	}
+	return capacity
 }
 
 func SummarizeCluster(nodes []torque.Node, jobs []torque.Job) ClusterSummary {
@@ -119,7 +327,7 @@ func SummarizeCluster(nodes []torque.Node, jobs []torque.Job) ClusterSummary {
 }
 
 func SummarizeNodes(nodes []torque.Node, jobs []torque.Job) []NodeSummary {
-	var sums []NodeSummary
+	sums := []NodeSummary{}
 
 	index := map[string]int{}
 
@@ -143,7 +351,7 @@ func SummarizeNodes(nodes []torque.Node, jobs []torque.Job) []NodeSummary {
 	}
 
 	// FIXME: inefficient
-	jobSum := SummarizeJobs(jobs)
+	jobSum := SummarizeJobs(jobs, Grouping{}, JobOrder{})
 
 	hostOwners := map[string]map[string]int{}
 	for _, node := range nodes {
@@ -167,7 +375,10 @@ func SummarizeNodes(nodes []torque.Node, jobs []torque.Job) []NodeSummary {
 		}
 
 		sort.Slice(ownersSum, func(i, j int) bool {
-			return ownersSum[i].Occupancy > ownersSum[j].Occupancy
+			if ownersSum[i].Occupancy != ownersSum[j].Occupancy {
+				return ownersSum[i].Occupancy > ownersSum[j].Occupancy
+			}
+			return ownersSum[i].Owner < ownersSum[j].Owner
 		})
 
 		sums[index[host]].Owners = ownersSum
@@ -176,26 +387,19 @@ func SummarizeNodes(nodes []torque.Node, jobs []torque.Job) []NodeSummary {
 	return sums
 }
 
-func SummarizeJobs(jobs []torque.Job) []JobSummary {
-	type groupKey struct {
-		Name  string
-		Owner string
-		State string
-	}
+// SummarizeJobs groups jobs as specified by grouping and returns the groups
+// in given order. The queue time of a group is the earliest one of the jobs.
+func SummarizeJobs(jobs []torque.Job, grouping Grouping, order JobOrder) []JobSummary {
 	sumsMap := map[groupKey]*JobSummary{}
 
 	for _, job := range jobs {
-		key := groupKey{
-			Name:  basename(job.Name),
-			Owner: job.Owner,
-			State: job.State,
-		}
+		key, name := grouping.group(job)
 
 		sum, ok := sumsMap[key]
 		if !ok {
 			sum = &JobSummary{
 				State:         key.State,
-				Name:          key.Name,
+				Name:          name,
 				Owner:         key.Owner,
 				HostOccupancy: map[string]int{},
 			}
@@ -204,12 +408,24 @@ func SummarizeJobs(jobs []torque.Job) []JobSummary {
 
 		sum.Count++
 		sum.IDs = append(sum.IDs, job.ID)
+		sum.Queue = appendDistinct(sum.Queue, job.Queue)
+		sum.Account = appendDistinct(sum.Account, job.Account)
+		sum.ExitStatus = appendDistinct(sum.ExitStatus, job.ExitStatus)
+
+		if job.RequestedWalltime > sum.RequestedWalltime {
+			sum.RequestedWalltime = job.RequestedWalltime
+		}
+
+		if job.QueueTime != 0 && (sum.QueueTime == 0 || job.QueueTime < sum.QueueTime) {
+			sum.QueueTime = job.QueueTime
+		}
 
 		if job.State != "R" {
 			continue
 		}
 
 		sum.Occupancy += len(job.ExecSlots)
+		sum.Memory += job.Memory
 		for _, slot := range job.ExecSlots {
 			sum.HostOccupancy[slot.Node]++
 		}
@@ -228,19 +444,34 @@ func SummarizeJobs(jobs []torque.Job) []JobSummary {
 		}
 	}
 
-	var sums []JobSummary
+	sums := []JobSummary{}
 
 	for _, sum := range sumsMap {
 		sums = append(sums, *sum)
 	}
 
 	sort.Slice(sums, func(i, j int) bool {
-		return compareJobs(sums[i], sums[j]) < 0
+		return order.Less(sums[i], sums[j])
 	})
 
 	return sums
 }
 
+// appendDistinct appends value to a comma-separated list unless the list
+// already has the value or the value is empty.
+func appendDistinct(list, value string) string {
+	if value == "" {
+		return list
+	}
+	if list == "" {
+		return value
+	}
+	if containsString(strings.Split(list, ","), value) {
+		return list
+	}
+	return list + "," + value
+}
+
 func basename(s string) string {
 	return jobSuffixPattern.ReplaceAllString(s, "")
 }
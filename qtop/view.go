@@ -0,0 +1,147 @@
+package qtop
+
+// A viewport is a vertically scrollable window over a list of rows with a
+// cursor selecting one of the rows.
+type viewport struct {
+	// top is the screen row where the viewport is drawn.
+	top int
+
+	// height is the number of screen rows allocated to the viewport.
+	height int
+
+	// offset is the index of the first visible row.
+	offset int
+
+	// cursor is the index of the selected row.
+	cursor int
+
+	// total is the number of rows in the list.
+	total int
+}
+
+// clipped returns true if some rows are not visible.
+func (v *viewport) clipped() bool {
+	return v.total > v.height
+}
+
+// rows returns the number of list rows visible in the viewport. The last
+// screen row of a clipped viewport is used for the "more" marker.
+func (v *viewport) rows() int {
+	if v.clipped() && v.height > 0 {
+		return v.height - 1
+	}
+	return v.height
+}
+
+// layout sets the position and size of the viewport and the number of rows in
+// the list, keeping the offset and the cursor in valid ranges.
+func (v *viewport) layout(top, height, total int) {
+	v.top = top
+	v.height = height
+	v.total = total
+	v.move(0)
+}
+
+// scroll moves the viewport down by n rows, or up if n is negative. The
+// cursor is kept in the viewport.
+func (v *viewport) scroll(n int) {
+	v.offset += n
+
+	if max := v.total - v.rows(); v.offset > max {
+		v.offset = max
+	}
+
+	if v.offset < 0 {
+		v.offset = 0
+	}
+
+	if v.cursor < v.offset {
+		v.cursor = v.offset
+	}
+
+	if last := v.offset + v.rows() - 1; v.cursor > last && last >= v.offset {
+		v.cursor = last
+	}
+}
+
+// move moves the cursor down by n rows, or up if n is negative, and scrolls
+// the viewport to show the cursor.
+func (v *viewport) move(n int) {
+	v.cursor += n
+
+	if v.cursor >= v.total {
+		v.cursor = v.total - 1
+	}
+
+	if v.cursor < 0 {
+		v.cursor = 0
+	}
+
+	if v.cursor < v.offset {
+		v.offset = v.cursor
+	}
+
+	if v.rows() > 0 && v.cursor >= v.offset+v.rows() {
+		v.offset = v.cursor - v.rows() + 1
+	}
+
+	v.scroll(0)
+}
+
+// page scrolls the viewport and the cursor by n pages.
+func (v *viewport) page(n int) {
+	step := v.rows() - 1
+	if step < 1 {
+		step = 1
+	}
+	v.cursor += n * step
+	v.scroll(n * step)
+	v.move(0)
+}
+
+// home moves the cursor to the first row.
+func (v *viewport) home() {
+	v.move(-v.total)
+}
+
+// end moves the cursor to the last row.
+func (v *viewport) end() {
+	v.move(v.total)
+}
+
+// contains returns true if screen row y is in the viewport.
+func (v *viewport) contains(y int) bool {
+	return y >= v.top && y < v.top+v.height
+}
+
+// hidden returns the numbers of rows hidden above and below the viewport.
+func (v *viewport) hidden() (int, int) {
+	below := v.total - v.offset - v.rows()
+	if below < 0 {
+		below = 0
+	}
+	return v.offset, below
+}
+
+// splitHeights divides avail screen rows between the node and job lists. Both
+// lists are shown in full if possible. Otherwise the node list is given at
+// most half of the rows unless the job list is short.
+func splitHeights(avail, nodes, jobs int) (int, int) {
+	if avail < 0 {
+		avail = 0
+	}
+
+	if nodes+jobs <= avail {
+		return nodes, avail - nodes
+	}
+
+	nodeHeight := avail / 2
+	if avail-jobs > nodeHeight {
+		nodeHeight = avail - jobs
+	}
+	if nodes < nodeHeight {
+		nodeHeight = nodes
+	}
+
+	return nodeHeight, avail - nodeHeight
+}
@@ -0,0 +1,65 @@
+package qtop
+
+import (
+	"testing"
+)
+
+func Test_splitHeights(t *testing.T) {
+	testCases := []struct {
+		avail, nodes, jobs int
+		nodeHeight         int
+		jobHeight          int
+	}{
+		{20, 5, 10, 5, 15},
+		{20, 30, 40, 10, 10},
+		{20, 30, 4, 16, 4},
+		{20, 3, 40, 3, 17},
+		{0, 3, 4, 0, 0},
+	}
+
+	for _, tc := range testCases {
+		nodeHeight, jobHeight := splitHeights(tc.avail, tc.nodes, tc.jobs)
+
+		if nodeHeight != tc.nodeHeight || jobHeight != tc.jobHeight {
+			t.Errorf(
+				"splitHeights(%d, %d, %d): got (%d, %d), want (%d, %d)",
+				tc.avail, tc.nodes, tc.jobs,
+				nodeHeight, jobHeight,
+				tc.nodeHeight, tc.jobHeight,
+			)
+		}
+	}
+}
+
+func Test_viewport_ClampsScrolling(t *testing.T) {
+	var view viewport
+	view.layout(0, 10, 25)
+
+	// The last row is used by the marker, so 9 rows are visible.
+	view.end()
+	if view.offset != 16 {
+		t.Errorf("unexpected offset at end: got %d, want 16", view.offset)
+	}
+
+	view.scroll(5)
+	if view.offset != 16 {
+		t.Errorf("scrolled past end: got %d, want 16", view.offset)
+	}
+
+	view.page(-1)
+	if view.offset != 8 {
+		t.Errorf("unexpected offset after page up: got %d, want 8", view.offset)
+	}
+
+	view.scroll(-100)
+	if view.offset != 0 {
+		t.Errorf("scrolled past top: got %d, want 0", view.offset)
+	}
+
+	// Shrinking list brings the viewport back.
+	view.end()
+	view.layout(0, 10, 5)
+	if view.offset != 0 {
+		t.Errorf("offset not clamped after shrink: got %d, want 0", view.offset)
+	}
+}
@@ -17,14 +17,17 @@ const (
 
 // A Node contains information of a compute node.
 type Node struct {
-	Name      string
-	State     string
-	SlotCount int
+	Name       string            `json:"name"`
+	State      string            `json:"state"`
+	SlotCount  int               `json:"slot_count"`
+	Properties []string          `json:"properties,omitempty"`
+	Note       string            `json:"note,omitempty"`
+	Status     map[string]string `json:"status,omitempty"`
 }
 
 // QueryNodes returns the state of the compute nodes in the cluster.
 func QueryNodes(c Conn) ([]Node, error) {
-	entities, err := queryEntity(c, pbsBatchStatusNode)
+	entities, err := queryEntity(c, pbsBatchStatusNode, "")
 	if err != nil {
 		return nil, err
 	}
@@ -37,11 +40,22 @@ func QueryNodes(c Conn) ([]Node, error) {
 			return nil, err
 		}
 
-		nodes = append(nodes, Node{
+		node := Node{
 			Name:      ent.name,
 			State:     ent.attrs["state"],
 			SlotCount: np,
-		})
+			Note:      ent.attrs["note"],
+		}
+
+		if props, ok := ent.attrs["properties"]; ok && props != "" {
+			node.Properties = strings.Split(props, ",")
+		}
+
+		if status, ok := ent.attrs["status"]; ok && status != "" {
+			node.Status = parseNodeStatus(status)
+		}
+
+		nodes = append(nodes, node)
 	}
 
 	return nodes, err
@@ -49,24 +63,31 @@ func QueryNodes(c Conn) ([]Node, error) {
 
 // A Job contains information of a batch job.
 type Job struct {
-	ID        string
-	Name      string
-	Owner     string
-	State     string
-	ExecSlots []Slot
-	Walltime  int
-	CPUTime   int
+	ID                string `json:"id"`
+	Name              string `json:"name"`
+	Owner             string `json:"owner"`
+	State             string `json:"state"`
+	Queue             string `json:"queue"`
+	Account           string `json:"account,omitempty"`
+	ExecSlots         []Slot `json:"exec_slots"`
+	Walltime          int    `json:"walltime"`
+	RequestedWalltime int    `json:"requested_walltime,omitempty"`
+	CPUTime           int    `json:"cpu_time"`
+	Memory            int64  `json:"memory,omitempty"`
+	QueueTime         int64  `json:"queue_time"`
+	StartTime         int64  `json:"start_time,omitempty"`
+	ExitStatus        string `json:"exit_status,omitempty"`
 }
 
 // A Slot identifies a single execution slot in the job scheduler.
 type Slot struct {
-	Node  string
-	Index int
+	Node  string `json:"node"`
+	Index int    `json:"index"`
 }
 
 // QueryJobs returns the state of the batch jobs in the cluster.
 func QueryJobs(c Conn) ([]Job, error) {
-	entities, err := queryEntity(c, pbsBatchStatusJob)
+	entities, err := queryEntity(c, pbsBatchStatusJob, "")
 	if err != nil {
 		return nil, err
 	}
@@ -75,10 +96,13 @@ func QueryJobs(c Conn) ([]Job, error) {
 
 	for _, ent := range entities {
 		job := Job{
-			ID:    ent.name,
-			Name:  ent.attrs["Job_Name"],
-			Owner: ent.attrs["Job_Owner"],
-			State: ent.attrs["job_state"],
+			ID:         ent.name,
+			Name:       ent.attrs["Job_Name"],
+			Owner:      ent.attrs["Job_Owner"],
+			State:      ent.attrs["job_state"],
+			Queue:      ent.attrs["queue"],
+			Account:    ent.attrs["Account_Name"],
+			ExitStatus: ent.attrs["exit_status"],
 		}
 
 		if execHost, ok := ent.attrs["exec_host"]; ok {
@@ -102,12 +126,55 @@ func QueryJobs(c Conn) ([]Job, error) {
 			}
 		}
 
+		// The attributes below are informational. A value that does not
+		// parse is left zero so that a single odd job does not hide the
+		// whole queue.
+
+		if walltime, ok := ent.attrs["Resource_List.walltime"]; ok {
+			if v, err := parseClock(walltime); err == nil {
+				job.RequestedWalltime = v
+			}
+		}
+
+		if mem, ok := ent.attrs["resources_used.mem"]; ok {
+			if v, err := parseSize(mem); err == nil {
+				job.Memory = v
+			}
+		}
+
+		if qtime, ok := ent.attrs["qtime"]; ok {
+			if v, err := strconv.ParseInt(qtime, 10, 64); err == nil {
+				job.QueueTime = v
+			}
+		}
+
+		if stime, ok := ent.attrs["start_time"]; ok {
+			if v, err := strconv.ParseInt(stime, 10, 64); err == nil {
+				job.StartTime = v
+			}
+		}
+
 		jobs = append(jobs, job)
 	}
 
 	return jobs, err
 }
 
+// QueryJobAttrs returns all the attributes of the job with given ID as a map.
+// Resource subkeys are concatenated to main keys with delimiter ".".
+func QueryJobAttrs(c Conn, id string) (map[string]string, error) {
+	entities, err := queryEntity(c, pbsBatchStatusJob, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entities) != 1 {
+		return nil, fmt.Errorf("unexpected number of jobs: %d", len(entities))
+	}
+
+	return entities[0].attrs, nil
+}
+
 // parseExecHost parses s as an exec_host attribute.
 //
 // exec_host  = host_slots *( "+" host_slots )
@@ -149,6 +216,23 @@ func parseExecHost(s string) ([]Slot, error) {
 	return r, nil
 }
 
+// parseNodeStatus parses s as a status attribute of a node.
+//
+// status = field *( "," field )
+// field  = key "=" value
+//
+// A field without "=" is taken as a key with empty value.
+func parseNodeStatus(s string) map[string]string {
+	status := map[string]string{}
+
+	for _, field := range strings.Split(s, ",") {
+		key, value := splitOnce(field, "=")
+		status[key] = value
+	}
+
+	return status
+}
+
 // parseClock parses a time string of the form [[hh:]mm:]ss and returns the time
 // represented by the string in seconds.
 func parseClock(s string) (int, error) {
@@ -171,6 +255,44 @@ func parseClock(s string) (int, error) {
 	return clock, nil
 }
 
+// sizeUnits lists the units of PBS size values. A word is eight bytes.
+var sizeUnits = []struct {
+	suffix string
+	scale  int64
+}{
+	{"kb", 1 << 10},
+	{"mb", 1 << 20},
+	{"gb", 1 << 30},
+	{"tb", 1 << 40},
+	{"pb", 1 << 50},
+	{"kw", 8 << 10},
+	{"mw", 8 << 20},
+	{"gw", 8 << 30},
+	{"tw", 8 << 40},
+	{"pw", 8 << 50},
+	{"b", 1},
+	{"w", 8},
+}
+
+// parseSize parses a size string like "2048kb" and returns the size in bytes.
+// A size without unit is in bytes.
+func parseSize(s string) (int64, error) {
+	num, scale := strings.ToLower(s), int64(1)
+
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(num, unit.suffix) {
+			num, scale = strings.TrimSuffix(num, unit.suffix), unit.scale
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * scale, nil
+}
+
 // splitOnce splits s at the first occurrence of sep.
 func splitOnce(s, sep string) (string, string) {
 	n := strings.Index(s, sep)
@@ -187,8 +309,9 @@ type entity struct {
 }
 
 // queryEntity sends a status request of some entity to the server and returns
-// the response as an array of entity objects.
-func queryEntity(conn Conn, fun int) ([]entity, error) {
+// the response as an array of entity objects. id selects a single entity if
+// not empty.
+func queryEntity(conn Conn, fun int, id string) ([]entity, error) {
 
 	// Request (See torque: src/lib/Libifl/PBSD_status2.c)
 	//
@@ -205,7 +328,7 @@ func queryEntity(conn Conn, fun int) ([]entity, error) {
 	conn.WriteInt(pbsBatchProtVer)
 	conn.WriteInt(int64(fun))
 	conn.WriteString(conn.User())
-	conn.WriteString("")
+	conn.WriteString(id)
 	conn.WriteInt(0)
 	conn.WriteInt(0)
 
@@ -45,9 +45,12 @@ func Test_QueryNodes_ParsesServerResponse(t *testing.T) {
 	conn := &mockConn{[]interface{}{
 		2, 2, 0, 0, 6, 2,
 
-		-1, "foo", 2,
+		-1, "foo", 5,
 		-1, "state", 0, "free", 0,
 		-1, "np", 0, "10", 0,
+		-1, "properties", 0, "gpu,bigmem", 0,
+		-1, "note", 0, "fan replaced", 0,
+		-1, "status", 0, "opsys=linux,loadave=1.50,rectime=1500000000", 0,
 
 		-1, "bar", 2,
 		-1, "state", 0, "down", 0,
@@ -56,9 +59,16 @@ func Test_QueryNodes_ParsesServerResponse(t *testing.T) {
 
 	expected := []Node{
 		{
-			Name:      "foo",
-			State:     "free",
-			SlotCount: 10,
+			Name:       "foo",
+			State:      "free",
+			SlotCount:  10,
+			Properties: []string{"gpu", "bigmem"},
+			Note:       "fan replaced",
+			Status: map[string]string{
+				"opsys":   "linux",
+				"loadave": "1.50",
+				"rectime": "1500000000",
+			},
 		},
 		{
 			Name:      "bar",
@@ -83,30 +93,47 @@ func Test_QueryNodes_ParsesServerResponse(t *testing.T) {
 
 func Test_QueryJobs_ParsesServerResponse(t *testing.T) {
 	conn := &mockConn{[]interface{}{
-		2, 2, 0, 0, 6, 2,
+		2, 2, 0, 0, 6, 3,
 
-		-1, "101", 6,
+		-1, "101", 12,
 		-1, "Job_Name", 0, "foo", 0,
 		-1, "Job_Owner", 0, "alice@example.com", 0,
 		-1, "job_state", 0, "R", 0,
+		-1, "queue", 0, "batch", 0,
 		-1, "exec_host", 0, "node01/1,5-6+node02/3", 0,
 		-1, "resources_used", 1, "walltime", "12:34:56", 0,
 		-1, "resources_used", 1, "cput", "7:08:09", 0,
+		-1, "qtime", 0, "1500000000", 0,
+		-1, "start_time", 0, "1500000100", 0,
+		-1, "Resource_List", 1, "walltime", "24:00:00", 0,
+		-1, "resources_used", 1, "mem", "2048kb", 0,
+		-1, "Account_Name", 0, "proj", 0,
 
 		-1, "102", 3,
 		-1, "Job_Name", 0, "bar", 0,
 		-1, "Job_Owner", 0, "bob@example.com", 0,
 		-1, "job_state", 0, "Q", 0,
+
+		-1, "103", 3,
+		-1, "Job_Name", 0, "baz", 0,
+		-1, "job_state", 0, "C", 0,
+		-1, "exit_status", 0, "271", 0,
 	}}
 
 	expected := []Job{
 		{
-			ID:       "101",
-			Name:     "foo",
-			Owner:    "alice@example.com",
-			State:    "R",
-			Walltime: (12*60+34)*60 + 56,
-			CPUTime:  (7*60+8)*60 + 9,
+			ID:                "101",
+			Name:              "foo",
+			Owner:             "alice@example.com",
+			State:             "R",
+			Queue:             "batch",
+			Account:           "proj",
+			Walltime:          (12*60+34)*60 + 56,
+			RequestedWalltime: 24 * 60 * 60,
+			CPUTime:           (7*60+8)*60 + 9,
+			Memory:            2048 * 1024,
+			QueueTime:         1500000000,
+			StartTime:         1500000100,
 			ExecSlots: []Slot{
 				{"node01", 1},
 				{"node01", 5},
@@ -120,6 +147,12 @@ func Test_QueryJobs_ParsesServerResponse(t *testing.T) {
 			Owner: "bob@example.com",
 			State: "Q",
 		},
+		{
+			ID:         "103",
+			Name:       "baz",
+			State:      "C",
+			ExitStatus: "271",
+		},
 	}
 
 	actual, err := QueryJobs(conn)
@@ -135,3 +168,92 @@ func Test_QueryJobs_ParsesServerResponse(t *testing.T) {
 		t.Errorf("unexpected result: got %v, want %v", actual, expected)
 	}
 }
+
+func Test_QueryJobs_IgnoresBadOptionalAttributes(t *testing.T) {
+	conn := &mockConn{[]interface{}{
+		2, 2, 0, 0, 6, 2,
+
+		-1, "101", 7,
+		-1, "Job_Name", 0, "foo", 0,
+		-1, "job_state", 0, "R", 0,
+		-1, "resources_used", 1, "cput", "1:00:00", 0,
+		-1, "qtime", 0, "yesterday", 0,
+		-1, "start_time", 0, "", 0,
+		-1, "Resource_List", 1, "walltime", "unlimited", 0,
+		-1, "resources_used", 1, "mem", "lots", 0,
+
+		-1, "102", 2,
+		-1, "Job_Name", 0, "bar", 0,
+		-1, "job_state", 0, "Q", 0,
+	}}
+
+	expected := []Job{
+		{ID: "101", Name: "foo", State: "R", CPUTime: 60 * 60},
+		{ID: "102", Name: "bar", State: "Q"},
+	}
+
+	actual, err := QueryJobs(conn)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("unexpected result: got %v, want %v", actual, expected)
+	}
+}
+
+func Test_parseSize(t *testing.T) {
+	testCases := []struct {
+		s    string
+		size int64
+	}{
+		{"123", 123},
+		{"512b", 512},
+		{"2kb", 2048},
+		{"3MB", 3 << 20},
+		{"1gb", 1 << 30},
+		{"2w", 16},
+		{"1kw", 8192},
+	}
+
+	for _, tc := range testCases {
+		size, err := parseSize(tc.s)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", tc.s, err)
+			continue
+		}
+		if size != tc.size {
+			t.Errorf("%q: got %d, want %d", tc.s, size, tc.size)
+		}
+	}
+
+	if _, err := parseSize("12xb"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func Test_QueryJobAttrs_ParsesServerResponse(t *testing.T) {
+	conn := &mockConn{[]interface{}{
+		2, 2, 0, 0, 6, 1,
+
+		-1, "101", 3,
+		-1, "Job_Name", 0, "foo", 0,
+		-1, "Resource_List", 1, "walltime", "24:00:00", 0,
+		-1, "comment", 0, "Job started", 0,
+	}}
+
+	expected := map[string]string{
+		"Job_Name":               "foo",
+		"Resource_List.walltime": "24:00:00",
+		"comment":                "Job started",
+	}
+
+	actual, err := QueryJobAttrs(conn, "101")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("unexpected result: got %v, want %v", actual, expected)
+	}
+}